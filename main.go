@@ -1,27 +1,35 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
+	"time"
 
+	"github.com/deps-cloud/api"
 	"github.com/deps-cloud/api/v1alpha/store"
 	"github.com/deps-cloud/tracker/pkg/services"
 	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+	"github.com/deps-cloud/tracker/pkg/types"
 
 	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/jmoiron/sqlx"
 
+	_ "github.com/lib/pq"
+
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
 
+	bolt "go.etcd.io/bbolt"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
@@ -35,55 +43,137 @@ func panicIff(err error) {
 	}
 }
 
-func registerV1Alpha(rwdb, rodb *sqlx.DB, statements *graphstore.Statements, server *grpc.Server) {
-	graphStore, err := graphstore.NewSQLGraphStore(rwdb, rodb, statements)
-	panicIff(err)
+// searchTypes are the types of nodes found by the search service, which are the
+// only nodes kept in the search index of SQL graph stores.
+var searchTypes = []string{types.ModuleType, types.SourceType}
+
+func newSQLGraphStore(connect func(address string) (*sqlx.DB, error), storageAddress, storageReadOnlyAddress, storageStatementsFile string, storageQueryTimeout time.Duration) (store.GraphStoreServer, error) {
+	var rwdb *sqlx.DB
+	var err error
+
+	if len(storageAddress) > 0 {
+		rwdb, err = connect(storageAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rodb := rwdb
+	if len(storageReadOnlyAddress) > 0 {
+		rodb, err = connect(storageReadOnlyAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rodb == nil && rwdb == nil {
+		return nil, fmt.Errorf("either --storage-address or --storage-readonly-address must be provided")
+	}
+
+	// nil statements are resolved using the storage driver
+	var statements *graphstore.Statements
+	if len(storageStatementsFile) > 0 {
+		statements, err = graphstore.LoadStatementsFile(storageStatementsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return graphstore.NewSQLGraphStore(rwdb, rodb, statements,
+		graphstore.WithQueryTimeout(storageQueryTimeout),
+		graphstore.WithSearchTypes(searchTypes...))
+}
+
+// defaultStorageAddress is an in memory sqlite3 database, which is not a valid
+// path for the bolt storage driver.
+const defaultStorageAddress = "file::memory:?cache=shared"
+
+func newBoltGraphStore(storageAddress string) (store.GraphStoreServer, error) {
+	if len(storageAddress) == 0 || storageAddress == defaultStorageAddress {
+		return nil, fmt.Errorf("--storage-address must be set to the path of the database file when using the bolt storage driver")
+	}
+
+	db, err := bolt.Open(storageAddress, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
 
-	graphStoreClient := store.NewInProcessGraphStoreClient(graphStore)
+	return graphstore.NewBoltGraphStore(db)
+}
 
+func registerV1Alpha(graphStoreClient store.GraphStoreClient, server *grpc.Server) {
 	// v1alpha
 	services.RegisterDependencyService(server, graphStoreClient)
 	services.RegisterModuleService(server, graphStoreClient)
 	services.RegisterSourceService(server, graphStoreClient)
 	services.RegisterTopologyService(server, graphStoreClient)
+	services.RegisterTopologyStreamService(server, graphStoreClient)
+	services.RegisterRevisionService(server, graphStoreClient)
+	services.RegisterSearchService(server, graphStoreClient)
 }
 
 func main() {
 	port := 8090
 	storageDriver := "sqlite3"
-	storageAddress := "file::memory:?cache=shared"
+	storageAddress := defaultStorageAddress
 	storageReadOnlyAddress := ""
 	storageStatementsFile := ""
+	storageQueryTimeout := time.Duration(0)
+	storageConnectTimeout := time.Minute
+	storagePool := &graphstore.PoolOptions{}
 	tlsKey := ""
 	tlsCert := ""
 	tlsCA := ""
+	gcInterval := time.Hour
+	cacheSize := 0
+	cacheTTL := time.Minute
+	cacheStatsInterval := time.Minute
+	// deleted rows are kept unless a retention is configured, since purging them
+	// makes point in time queries older than the retention incomplete
+	gcRetention := time.Duration(0)
+
+	// the database may come up after the tracker, so connecting is retried
+	connect := func(address string) (*sqlx.DB, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), storageConnectTimeout)
+		defer cancel()
+
+		return graphstore.Connect(ctx, storageDriver, address, storagePool)
+	}
+
+	newGraphStore := func() (store.GraphStoreServer, error) {
+		switch storageDriver {
+		case "memory":
+			return graphstore.NewMemoryGraphStore(), nil
+		case "bolt":
+			return newBoltGraphStore(storageAddress)
+		default:
+			return newSQLGraphStore(connect, storageAddress, storageReadOnlyAddress, storageStatementsFile, storageQueryTimeout)
+		}
+	}
+
+	// orphaned modules and revisions are collected alongside soft deleted rows
+	orphanTypes := []string{types.ModuleType, types.RevisionType}
 
 	cmd := &cobra.Command{
 		Use:   "tracker",
 		Short: "tracker runs the dependency tracking service.",
 		Run: func(cmd *cobra.Command, args []string) {
-			var rwdb *sqlx.DB
-			var err error
-
-			if len(storageAddress) > 0 {
-				rwdb, err = sqlx.Open(storageDriver, storageAddress)
-				panicIff(err)
-			}
-
-			rodb := rwdb
-			if len(storageReadOnlyAddress) > 0 {
-				rodb, err = sqlx.Open(storageDriver, storageReadOnlyAddress)
-				panicIff(err)
-			}
+			graphStore, err := newGraphStore()
+			panicIff(err)
 
-			if rodb == nil && rwdb == nil {
-				panicIff(fmt.Errorf("either --storage-address or --storage-readonly-address must be provided"))
+			graphStoreClient := graphstore.NewInProcessGraphStoreClient(graphStore)
+			if cacheSize > 0 {
+				cache := graphstore.NewCachingGraphStoreClient(graphStoreClient, cacheSize, cacheTTL)
+				if cacheStatsInterval > 0 {
+					go graphstore.RunCacheStats(context.Background(), cache, cacheStatsInterval)
+				}
+				graphStoreClient = cache
 			}
 
-			statements := graphstore.DefaultStatements()
-			if len(storageStatementsFile) > 0 {
-				statements, err = graphstore.LoadStatementsFile(storageStatementsFile)
-				panicIff(err)
+			// the compactor shares the client of the services so that the cache
+			// is dropped after each compaction
+			if compactor, ok := graphStoreClient.(graphstore.Compactor); ok && gcInterval > 0 {
+				go graphstore.RunCompactor(context.Background(), compactor, gcInterval, gcRetention, orphanTypes)
 			}
 
 			options := make([]grpc.ServerOption, 0)
@@ -113,7 +203,7 @@ func main() {
 
 			server := grpc.NewServer(options...)
 			healthpb.RegisterHealthServer(server, health.NewServer())
-			registerV1Alpha(rwdb, rodb, statements, server)
+			registerV1Alpha(graphStoreClient, server)
 
 			// setup server
 			address := fmt.Sprintf(":%d", port)
@@ -127,15 +217,99 @@ func main() {
 		},
 	}
 
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "migrate applies any pending schema migrations to the storage tier and rebuilds its search index.",
+		Run: func(cmd *cobra.Command, args []string) {
+			switch storageDriver {
+			case "memory", "bolt":
+				panicIff(fmt.Errorf("the %s storage driver does not use schema migrations", storageDriver))
+			}
+
+			if len(storageAddress) == 0 {
+				panicIff(fmt.Errorf("--storage-address must be provided"))
+			}
+
+			db, err := connect(storageAddress)
+			panicIff(err)
+			defer db.Close()
+
+			statements, err := graphstore.StatementsForDriver(storageDriver)
+			if len(storageStatementsFile) > 0 {
+				statements, err = graphstore.LoadStatementsFile(storageStatementsFile)
+			}
+			panicIff(err)
+
+			err = graphstore.Migrate(db, statements)
+			panicIff(err)
+
+			version, err := graphstore.CurrentSchemaVersion(db, statements)
+			panicIff(err)
+
+			logrus.Infof("[main] database schema is at version %d", version)
+
+			// nodes written before the search index existed are only found once
+			// they are indexed
+			graphStore, err := graphstore.NewSQLGraphStore(db, db, statements, graphstore.WithSearchTypes(searchTypes...))
+			panicIff(err)
+
+			indexed, err := graphStore.(graphstore.Indexer).Reindex(context.Background(), searchTypes)
+			if err == api.ErrUnimplemented {
+				logrus.Infof("[main] the statements do not support reindexing, skipping the search index")
+				return
+			}
+			panicIff(err)
+
+			logrus.Infof("[main] indexed %d nodes for search", indexed)
+		},
+	}
+
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "gc removes orphaned modules and revisions and rows deleted longer than the retention period.",
+		Run: func(cmd *cobra.Command, args []string) {
+			graphStore, err := newGraphStore()
+			panicIff(err)
+
+			compactor, ok := graphStore.(graphstore.Compactor)
+			if !ok {
+				panicIff(fmt.Errorf("the %s storage driver does not support garbage collection", storageDriver))
+			}
+
+			resp, err := compactor.Compact(context.Background(), &graphstore.CompactRequest{
+				DeletedBefore: graphstore.DeletedBefore(gcRetention),
+				NodeTypes:     orphanTypes,
+			})
+			panicIff(err)
+
+			logrus.Infof("[main] removed %d orphaned nodes and purged %d deleted rows", resp.Orphaned, resp.Purged)
+		},
+	}
+
+	cmd.AddCommand(migrate, gc)
+
 	flags := cmd.Flags()
 	flags.IntVar(&port, "port", port, "(optional) the port to run on")
-	flags.StringVar(&storageDriver, "storage-driver", storageDriver, "(optional) the driver used to configure the storage tier")
-	flags.StringVar(&storageAddress, "storage-address", storageAddress, "(optional) the address of the storage tier")
-	flags.StringVar(&storageReadOnlyAddress, "storage-readonly-address", storageReadOnlyAddress, "(optional) the readonly address of the storage tier")
-	flags.StringVar(&storageStatementsFile, "storage-statements-file", storageStatementsFile, "(optional) path to a yaml file containing the definition of each SQL statement")
 	flags.StringVar(&tlsKey, "tls-key", tlsKey, "(optional) path to the file containing the TLS private key")
 	flags.StringVar(&tlsCert, "tls-cert", tlsCert, "(optional) path to the file containing the TLS certificate")
 	flags.StringVar(&tlsCA, "tls-ca", tlsCA, "(optional) path to the file containing the TLS certificate authority")
+	flags.DurationVar(&gcInterval, "gc-interval", gcInterval, "(optional) how often to collect garbage from the storage tier, or 0 to disable")
+	flags.IntVar(&cacheSize, "cache-size", cacheSize, "(optional) how many graph store lookups to cache, or 0 to disable caching")
+	flags.DurationVar(&cacheTTL, "cache-ttl", cacheTTL, "(optional) how long cached graph store lookups are served before they are read again")
+	flags.DurationVar(&cacheStatsInterval, "cache-stats-interval", cacheStatsInterval, "(optional) how often to log the hits and misses of the cache, or 0 to disable")
+
+	// storage flags are shared with subcommands
+	flags = cmd.PersistentFlags()
+	flags.StringVar(&storageDriver, "storage-driver", storageDriver, "(optional) the driver used to configure the storage tier (sqlite3, mysql, postgres, bolt, memory)")
+	flags.StringVar(&storageAddress, "storage-address", storageAddress, "(optional) the address of the storage tier, or the path to the database file when using bolt")
+	flags.StringVar(&storageReadOnlyAddress, "storage-readonly-address", storageReadOnlyAddress, "(optional) the readonly address of the storage tier")
+	flags.StringVar(&storageStatementsFile, "storage-statements-file", storageStatementsFile, "(optional) path to a yaml file containing the definition of each SQL statement")
+	flags.DurationVar(&storageQueryTimeout, "storage-query-timeout", storageQueryTimeout, "(optional) how long a single query against the storage tier may run, or 0 for no limit")
+	flags.DurationVar(&storageConnectTimeout, "storage-connect-timeout", storageConnectTimeout, "(optional) how long to wait for the storage tier to become reachable on startup")
+	flags.IntVar(&storagePool.MaxOpenConns, "storage-max-open-conns", storagePool.MaxOpenConns, "(optional) the maximum number of open connections to each database, or 0 for no limit")
+	flags.IntVar(&storagePool.MaxIdleConns, "storage-max-idle-conns", storagePool.MaxIdleConns, "(optional) the maximum number of idle connections to each database, or 0 to keep the driver default")
+	flags.DurationVar(&storagePool.ConnMaxLifetime, "storage-conn-max-lifetime", storagePool.ConnMaxLifetime, "(optional) how long a connection may be reused, or 0 to reuse connections forever")
+	flags.DurationVar(&gcRetention, "gc-retention", gcRetention, "(optional) how long deleted rows are retained before garbage collection removes them, or 0 to keep them for point in time queries")
 
 	err := cmd.Execute()
 	panicIff(err)
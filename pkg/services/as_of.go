@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// asOfHeader is the request header used to read the graph as it existed at a
+// point in time. Its value must be an RFC 3339 timestamp. Only read requests
+// accept it. Points in time older than the garbage collection retention miss
+// the rows it purged, so deleted rows are kept unless a retention is set.
+// Rows that were deleted and later written again are missing before the
+// time they were written again.
+const asOfHeader = "x-as-of"
+
+// asOfFromContext returns a context that reads the graph at the point in time
+// provided in the request headers. The request context is returned as is when
+// no point in time was requested.
+func asOfFromContext(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(asOfHeader)) == 0 {
+		return ctx, nil
+	}
+
+	value := md.Get(asOfHeader)[0]
+
+	asOf, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s", asOfHeader, value)
+	}
+
+	return graphstore.WithAsOf(ctx, asOf), nil
+}
+
+// rejectAsOf fails requests that write to the graph while asking for a point
+// in time, since the changes they compute must be based on the current graph.
+func rejectAsOf(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok && len(md.Get(asOfHeader)) > 0 {
+		return status.Errorf(codes.InvalidArgument, "%s is not supported when writing to the graph", asOfHeader)
+	}
+	return nil
+}
@@ -23,6 +23,10 @@ func Decode(graphItem *store.GraphItem) (interface{}, error) {
 		item = &schema.Module{}
 	} else if itemType == types.DependsType {
 		item = &schema.Depends{}
+	} else if itemType == types.RevisionType {
+		item = &Revision{}
+	} else if itemType == types.RevisionSummaryType {
+		item = &RevisionSummary{}
 	} else {
 		return nil, fmt.Errorf("unrecognized node type")
 	}
@@ -30,6 +30,16 @@ func Encode(msg interface{}) (*store.GraphItem, error) {
 		k2 = key
 	case *schema.Depends:
 		graphItemType = types.DependsType
+	case *Revision:
+		graphItemType = types.RevisionType
+		key := keyForRevision(msg.(*Revision))
+		k1 = key
+		k2 = key
+	case *RevisionSummary:
+		graphItemType = types.RevisionSummaryType
+		key := keyForRevisionSummary(msg.(*RevisionSummary))
+		k1 = key
+		k2 = key
 	default:
 		return nil, fmt.Errorf("unrecognized type")
 	}
@@ -0,0 +1,53 @@
+package graphstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ApplyRequest describes a mutation of the graph. Deletes are applied before
+// Puts, so an item present in both remains in the graph.
+type ApplyRequest struct {
+	Deletes []*store.GraphItem
+	Puts    []*store.GraphItem
+}
+
+// ApplyResponse is returned once every item in an ApplyRequest was written.
+type ApplyResponse struct{}
+
+// Applier is implemented by graph stores that can delete and put items as a
+// single atomic operation. When any item fails, none of the items are applied
+// and the error identifies the failed items using the "deletes" and "puts"
+// fields.
+type Applier interface {
+	Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error)
+}
+
+var _ Applier = &graphStore{}
+
+func (gs *graphStore) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	if gs.rwdb == nil {
+		return nil, api.ErrUnsupported
+	}
+
+	timestamp := time.Now()
+
+	steps := []*writeStep{gs.deleteStep("deletes", req.Deletes, timestamp)}
+	steps = append(steps, gs.searchSteps("deletes", req.Deletes, true)...)
+	steps = append(steps, gs.putStep("puts", req.Puts, timestamp))
+	steps = append(steps, gs.searchSteps("puts", req.Puts, false)...)
+
+	err := gs.write(ctx, "apply", steps...)
+
+	if err != nil {
+		logrus.Errorf("[graphstore] %s", err.Error())
+		return nil, err
+	}
+
+	return &ApplyResponse{}, nil
+}
@@ -0,0 +1,33 @@
+package graphstore
+
+import (
+	"context"
+	"time"
+)
+
+type asOfKey struct{}
+
+// WithAsOf returns a context that queries the graph as it existed at t. Only
+// reads honour it, so it must not be used to compute changes to the graph.
+// Items keep a single interval, so putting a deleted item again replaces its
+// creation time and data, and points in time before it was deleted miss it.
+func WithAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// AsOf returns the point in time requested by the context, or nil when the
+// current graph was requested.
+func AsOf(ctx context.Context) *time.Time {
+	if ctx == nil {
+		return nil
+	}
+
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	if !ok {
+		return nil
+	}
+
+	// timestamps are stored in local time
+	t = t.Local()
+	return &t
+}
@@ -0,0 +1,199 @@
+package graphstore
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultMaxParameters is the lowest bind parameter limit across the supported
+// drivers. SQLite limits statements to 999 parameters by default.
+const defaultMaxParameters = 999
+
+var (
+	// valuesRow matches the row of an INSERT, e.g. VALUES (:k1, :k2)
+	valuesRow = regexp.MustCompile(`(?i)\bVALUES\s*\(`)
+	// whereRow matches the condition of an UPDATE, e.g. WHERE (k1 = :k1)
+	whereRow = regexp.MustCompile(`(?i)\bWHERE\s*\(`)
+	// namedParameter matches named parameters while skipping :: casts
+	namedParameter = regexp.MustCompile(`(^|[^:]):([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// batchFragment is part of a statement compiled to use bind parameters.
+type batchFragment struct {
+	query string
+	names []string
+}
+
+func newBatchFragment(fragment string) batchFragment {
+	names := make([]string, 0)
+	for _, match := range namedParameter.FindAllStringSubmatch(fragment, -1) {
+		names = append(names, match[2])
+	}
+
+	return batchFragment{
+		query: namedParameter.ReplaceAllString(fragment, "$1?"),
+		names: names,
+	}
+}
+
+// batchStatement splits a statement into the row that is repeated for each
+// item in a batch and the surrounding text that is shared by every item.
+type batchStatement struct {
+	prefix    batchFragment
+	row       batchFragment
+	separator string
+	suffix    batchFragment
+	// size is the number of rows that fit into a single statement
+	size int
+}
+
+// newBatchStatement prepares statement for batching. The repeated row is the
+// parenthesized group following VALUES, which is joined by commas, or the
+// parenthesized condition following WHERE, which is joined by OR. Named
+// parameters within the row take a different value for each item while those
+// outside of it are shared. Statements without a row are executed one item at
+// a time.
+func newBatchStatement(statement string, maxParameters int) *batchStatement {
+	start, separator := -1, ""
+	if loc := valuesRow.FindStringIndex(statement); loc != nil {
+		start, separator = loc[1]-1, ", "
+	} else if loc := whereRow.FindStringIndex(statement); loc != nil {
+		start, separator = loc[1]-1, " OR "
+	}
+
+	end := closingParen(statement, start)
+	if start < 0 || end < 0 {
+		return &batchStatement{row: newBatchFragment(statement), size: 1}
+	}
+
+	b := &batchStatement{
+		prefix:    newBatchFragment(statement[:start]),
+		row:       newBatchFragment(statement[start : end+1]),
+		separator: separator,
+		suffix:    newBatchFragment(statement[end+1:]),
+	}
+
+	if maxParameters <= 0 {
+		maxParameters = defaultMaxParameters
+	}
+
+	shared := len(b.prefix.names) + len(b.suffix.names)
+	if len(b.row.names) > 0 {
+		b.size = (maxParameters - shared) / len(b.row.names)
+	}
+
+	if b.size < 1 {
+		b.size = 1
+	}
+
+	return b
+}
+
+// closingParen returns the index of the paren closing the one at start.
+func closingParen(statement string, start int) int {
+	if start < 0 {
+		return -1
+	}
+
+	depth := 0
+	for i := start; i < len(statement); i++ {
+		switch statement[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// query expands the statement to hold the provided number of rows.
+func (b *batchStatement) query(rows int) string {
+	expanded := make([]string, rows)
+	for i := range expanded {
+		expanded[i] = b.row.query
+	}
+
+	return b.prefix.query + strings.Join(expanded, b.separator) + b.suffix.query
+}
+
+// args flattens the values for the rows in the order of the bind parameters.
+// Rows fall back to shared values for names they do not provide.
+func (b *batchStatement) args(shared map[string]interface{}, rows []map[string]interface{}) []interface{} {
+	args := make([]interface{}, 0, len(b.prefix.names)+len(rows)*len(b.row.names)+len(b.suffix.names))
+
+	for _, name := range b.prefix.names {
+		args = append(args, shared[name])
+	}
+
+	for _, row := range rows {
+		for _, name := range b.row.names {
+			if value, ok := row[name]; ok {
+				args = append(args, value)
+			} else {
+				args = append(args, shared[name])
+			}
+		}
+	}
+
+	for _, name := range b.suffix.names {
+		args = append(args, shared[name])
+	}
+
+	return args
+}
+
+// batchError identifies the chunk of rows that failed to execute.
+type batchError struct {
+	start int
+	end   int
+	err   error
+}
+
+func (e *batchError) Error() string {
+	return e.err.Error()
+}
+
+// exec runs the statement for every row, chunking the rows so that each
+// statement stays within the parameter limit. Full chunks share a prepared
+// statement. Execution stops at the first error, which is a *batchError.
+func (b *batchStatement) exec(ctx context.Context, tx *sqlx.Tx, shared map[string]interface{}, rows []map[string]interface{}) error {
+	var stmt *sqlx.Stmt
+
+	for start := 0; start < len(rows); start += b.size {
+		end := start + b.size
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		args := b.args(shared, rows[start:end])
+
+		if end-start < b.size {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(b.query(end-start)), args...); err != nil {
+				return &batchError{start, end, err}
+			}
+			continue
+		}
+
+		if stmt == nil {
+			var err error
+			if stmt, err = tx.PreparexContext(ctx, tx.Rebind(b.query(b.size))); err != nil {
+				return &batchError{start, end, err}
+			}
+			defer stmt.Close()
+		}
+
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return &batchError{start, end, err}
+		}
+	}
+
+	return nil
+}
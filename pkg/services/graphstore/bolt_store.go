@@ -0,0 +1,742 @@
+package graphstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	bolt "go.etcd.io/bbolt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// itemsBucket stores every graph item keyed by (k1, k2, graph_item_type).
+	// Since edges are keyed by their k1, it doubles as the forward edge index.
+	itemsBucket = []byte("dts_graphdata")
+	// reverseBucket indexes every graph item by (k2, k1, graph_item_type).
+	reverseBucket = []byte("dts_graphdata_reverse")
+	// typesBucket indexes every graph item by (graph_item_type, k1, k2).
+	typesBucket = []byte("dts_graphdata_types")
+)
+
+// boltRecord is the value stored for each graph item in the itemsBucket.
+type boltRecord struct {
+	Encoding      store.GraphItemEncoding `json:"encoding"`
+	GraphItemData []byte                  `json:"graph_item_data"`
+	LastModified  time.Time               `json:"last_modified"`
+	DateCreated   *time.Time              `json:"date_created,omitempty"`
+	DateDeleted   *time.Time              `json:"date_deleted,omitempty"`
+}
+
+// visible reports whether the record existed at the provided point in time,
+// or whether it currently exists when asOf is nil. Records written before
+// date_created was tracked are assumed to be created when last modified.
+func (r *boltRecord) visible(asOf *time.Time) bool {
+	if asOf == nil {
+		return r.DateDeleted == nil
+	}
+
+	created := r.LastModified
+	if r.DateCreated != nil {
+		created = *r.DateCreated
+	}
+
+	return !created.After(*asOf) && (r.DateDeleted == nil || r.DateDeleted.After(*asOf))
+}
+
+// boltKey joins the provided parts into a single key. Each part is prefixed
+// with its length so that the key for a subset of leading parts is always a
+// prefix of the key for the full set of parts.
+func boltKey(parts ...[]byte) []byte {
+	buf := make([]byte, 0)
+	size := make([]byte, binary.MaxVarintLen64)
+
+	for _, part := range parts {
+		n := binary.PutUvarint(size, uint64(len(part)))
+		buf = append(buf, size[:n]...)
+		buf = append(buf, part...)
+	}
+
+	return buf
+}
+
+// splitBoltKey reverses boltKey.
+func splitBoltKey(key []byte) [][]byte {
+	parts := make([][]byte, 0, 3)
+
+	for len(key) > 0 {
+		size, n := binary.Uvarint(key)
+		key = key[n:]
+		parts = append(parts, key[:size])
+		key = key[size:]
+	}
+
+	return parts
+}
+
+// NewBoltGraphStore constructs a new GraphStore backed by the provided bolt
+// database. Unlike the sql driven backend, no external database is required.
+func NewBoltGraphStore(db *bolt.DB) (store.GraphStoreServer, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{itemsBucket, reverseBucket, typesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltGraphStore{db: db}, nil
+}
+
+type boltGraphStore struct {
+	db *bolt.DB
+}
+
+var _ store.GraphStoreServer = &boltGraphStore{}
+var _ Traverser = &boltGraphStore{}
+var _ Applier = &boltGraphStore{}
+var _ Compactor = &boltGraphStore{}
+var _ Scanner = &boltGraphStore{}
+var _ Searcher = &boltGraphStore{}
+
+func (gs *boltGraphStore) Put(ctx context.Context, req *store.PutRequest) (*store.PutResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return &store.PutResponse{}, nil
+	}
+
+	timestamp := time.Now()
+
+	err := gs.db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		reverse := tx.Bucket(reverseBucket)
+		types := tx.Bucket(typesBucket)
+
+		for i, item := range req.GetItems() {
+			if err := putBoltItem(items, reverse, types, item, timestamp); err != nil {
+				return &ItemError{"items", i, item, err}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, boltWriteFailure("put", err)
+	}
+
+	return &store.PutResponse{}, nil
+}
+
+// putBoltItem writes the item and its index entries.
+func putBoltItem(items, reverse, types *bolt.Bucket, item *store.GraphItem, timestamp time.Time) error {
+	t := []byte(item.GetGraphItemType())
+	key := boltKey(item.GetK1(), item.GetK2(), t)
+
+	record := &boltRecord{
+		Encoding:      item.GetEncoding(),
+		GraphItemData: item.GetGraphItemData(),
+		LastModified:  timestamp,
+		DateCreated:   &timestamp,
+	}
+
+	// items that remain live keep the time they were created
+	if value := items.Get(key); value != nil {
+		existing := &boltRecord{}
+		if err := json.Unmarshal(value, existing); err != nil {
+			return err
+		}
+
+		if existing.DateDeleted == nil {
+			created := existing.LastModified
+			if existing.DateCreated != nil {
+				created = *existing.DateCreated
+			}
+			record.DateCreated = &created
+		}
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := items.Put(key, value); err != nil {
+		return err
+	}
+
+	if err := reverse.Put(boltKey(item.GetK2(), item.GetK1(), t), []byte{}); err != nil {
+		return err
+	}
+
+	return types.Put(boltKey(t, item.GetK1(), item.GetK2()), []byte{})
+}
+
+// boltWriteFailure reports an aborted write. Bolt rolls back the transaction
+// whenever the update returns an error, so none of the items were written.
+func boltWriteFailure(action string, err error) error {
+	if itemErr, ok := err.(*ItemError); ok {
+		return newWriteError(action, []*ItemError{itemErr})
+	}
+	return status.Errorf(codes.Aborted, "failed to %s items, no changes were made: %v", action, err)
+}
+
+func (gs *boltGraphStore) Delete(ctx context.Context, req *store.DeleteRequest) (*store.DeleteResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return &store.DeleteResponse{}, nil
+	}
+
+	timestamp := time.Now()
+
+	err := gs.db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+
+		for i, item := range req.GetItems() {
+			if err := deleteBoltItem(items, item, timestamp); err != nil {
+				return &ItemError{"items", i, item, err}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, boltWriteFailure("delete", err)
+	}
+
+	return &store.DeleteResponse{}, nil
+}
+
+// deleteBoltItem marks the item as deleted if it exists.
+func deleteBoltItem(items *bolt.Bucket, item *store.GraphItem, timestamp time.Time) error {
+	key := boltKey(item.GetK1(), item.GetK2(), []byte(item.GetGraphItemType()))
+
+	value := items.Get(key)
+	if value == nil {
+		return nil
+	}
+
+	record := &boltRecord{}
+	if err := json.Unmarshal(value, record); err != nil {
+		return err
+	}
+
+	record.DateDeleted = &timestamp
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return items.Put(key, value)
+}
+
+func (gs *boltGraphStore) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	if len(req.Deletes) == 0 && len(req.Puts) == 0 {
+		return &ApplyResponse{}, nil
+	}
+
+	timestamp := time.Now()
+
+	err := gs.db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		reverse := tx.Bucket(reverseBucket)
+		types := tx.Bucket(typesBucket)
+
+		for i, item := range req.Deletes {
+			if err := deleteBoltItem(items, item, timestamp); err != nil {
+				return &ItemError{"deletes", i, item, err}
+			}
+		}
+
+		for i, item := range req.Puts {
+			if err := putBoltItem(items, reverse, types, item, timestamp); err != nil {
+				return &ItemError{"puts", i, item, err}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, boltWriteFailure("apply", err)
+	}
+
+	return &ApplyResponse{}, nil
+}
+
+// hasLiveBoltEdges reports whether any live edge starts or ends at key.
+func hasLiveBoltEdges(tx *bolt.Tx, key []byte) (bool, error) {
+	for _, downstream := range []bool{false, true} {
+		bucket := itemsBucket
+		if downstream {
+			bucket = reverseBucket
+		}
+
+		prefix := boltKey(key)
+		cursor := tx.Bucket(bucket).Cursor()
+
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			parts := splitBoltKey(k)
+			near, far, t := parts[0], parts[1], parts[2]
+
+			if bytes.Equal(near, far) {
+				continue
+			}
+
+			k1, k2 := near, far
+			if downstream {
+				k1, k2 = far, near
+			}
+
+			edge, err := getBoltItem(tx, k1, k2, t)
+			if err != nil {
+				return false, err
+			} else if edge != nil {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (gs *boltGraphStore) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	timestamp := time.Now()
+	resp := &CompactResponse{}
+
+	err := gs.db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+
+		orphans := make([]*store.GraphItem, 0)
+		for _, nodeType := range req.NodeTypes {
+			prefix := boltKey([]byte(nodeType))
+			cursor := tx.Bucket(typesBucket).Cursor()
+
+			for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+				parts := splitBoltKey(k)
+				if !bytes.Equal(parts[1], parts[2]) {
+					continue
+				}
+
+				node, err := getBoltItem(tx, parts[1], parts[2], parts[0])
+				if err != nil {
+					return err
+				} else if node == nil {
+					continue
+				}
+
+				live, err := hasLiveBoltEdges(tx, node.GetK1())
+				if err != nil {
+					return err
+				} else if !live {
+					orphans = append(orphans, node)
+				}
+			}
+		}
+
+		// orphans are deleted first so they can be purged by a later compaction
+		for _, orphan := range orphans {
+			if err := deleteBoltItem(items, orphan, timestamp); err != nil {
+				return err
+			}
+		}
+		resp.Orphaned = int64(len(orphans))
+
+		purged := make([][]byte, 0)
+		err := items.ForEach(func(k, v []byte) error {
+			record := &boltRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+
+			if record.DateDeleted != nil && record.DateDeleted.Before(req.DeletedBefore) {
+				purged = append(purged, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range purged {
+			parts := splitBoltKey(k)
+			k1, k2, t := parts[0], parts[1], parts[2]
+
+			if err := items.Delete(k); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(reverseBucket).Delete(boltKey(k2, k1, t)); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(typesBucket).Delete(boltKey(t, k1, k2)); err != nil {
+				return err
+			}
+		}
+		resp.Purged = int64(len(purged))
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (gs *boltGraphStore) List(ctx context.Context, req *store.ListRequest) (*store.ListResponse, error) {
+	asOf := AsOf(ctx)
+
+	page := max(req.GetPage(), 1)
+
+	limit := ScanCount(req.GetCount())
+	offset := (page - 1) * limit
+
+	items := make([]*store.GraphItem, 0, limit)
+
+	err := gs.db.View(func(tx *bolt.Tx) error {
+		prefix := boltKey([]byte(req.GetType()))
+		cursor := tx.Bucket(typesBucket).Cursor()
+
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && int32(len(items)) < limit; k, _ = cursor.Next() {
+			parts := splitBoltKey(k)
+
+			item, err := getBoltItemAsOf(tx, parts[1], parts[2], parts[0], asOf)
+			if err != nil {
+				return err
+			} else if item == nil {
+				continue
+			}
+
+			if offset > 0 {
+				offset--
+				continue
+			}
+
+			items = append(items, item)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.ListResponse{
+		Items: items,
+	}, nil
+}
+
+func (gs *boltGraphStore) Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error) {
+	asOf := AsOf(ctx)
+
+	if err := validateScanFilters(req.Filters); err != nil {
+		return nil, err
+	}
+
+	token, err := decodeScanToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	count := ScanCount(req.Count)
+	total := int64(0)
+	items := make([]*store.GraphItem, 0, count+1)
+
+	// every item of the type is visited to count the matches
+	err = gs.db.View(func(tx *bolt.Tx) error {
+		prefix := boltKey([]byte(req.Type))
+		after := boltKey([]byte(req.Type), token.K1, token.K2)
+		cursor := tx.Bucket(typesBucket).Cursor()
+
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			parts := splitBoltKey(k)
+
+			item, err := getBoltItemAsOf(tx, parts[1], parts[2], parts[0], asOf)
+			if err != nil {
+				return err
+			} else if item == nil || !matchesScanFilters(item, req.Filters) {
+				continue
+			}
+
+			total++
+			if bytes.Compare(k, after) > 0 && int32(len(items)) <= count {
+				items = append(items, item)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newScanResponse(items, count, total), nil
+}
+
+func (gs *boltGraphStore) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	asOf := AsOf(ctx)
+
+	q, err := newSearchQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*SearchResult, 0)
+
+	// without an index, every node of the requested types is scored
+	err = gs.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(typesBucket).Cursor()
+
+		for _, t := range req.Types {
+			prefix := boltKey([]byte(t))
+
+			for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+				parts := splitBoltKey(k)
+				if !bytes.Equal(parts[1], parts[2]) {
+					continue
+				}
+
+				item, err := getBoltItemAsOf(tx, parts[1], parts[2], parts[0], asOf)
+				if err != nil {
+					return err
+				} else if item == nil {
+					continue
+				}
+
+				score, ok := q.score(item)
+				if !ok {
+					continue
+				}
+
+				dependents := int64(0)
+				if len(req.DependentTypes) > 0 {
+					pairs, err := findBoltPairs(tx, parts[1], req.DependentTypes, true, asOf)
+					if err != nil {
+						return err
+					}
+					dependents = int64(len(pairs))
+				}
+
+				results = append(results, &SearchResult{Item: item, Dependents: dependents, Score: score})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rankSearchResults(results, ScanCount(req.Count)), nil
+}
+
+// getBoltItem returns the live graph item with the provided keys, or nil if
+// it does not exist or has been deleted. The returned item does not reference
+// memory owned by the transaction.
+func getBoltItem(tx *bolt.Tx, k1, k2, t []byte) (*store.GraphItem, error) {
+	return getBoltItemAsOf(tx, k1, k2, t, nil)
+}
+
+// getBoltItemAsOf behaves like getBoltItem, but returns the item if it existed
+// at the provided point in time.
+func getBoltItemAsOf(tx *bolt.Tx, k1, k2, t []byte, asOf *time.Time) (*store.GraphItem, error) {
+	value := tx.Bucket(itemsBucket).Get(boltKey(k1, k2, t))
+	if value == nil {
+		return nil, nil
+	}
+
+	record := &boltRecord{}
+	if err := json.Unmarshal(value, record); err != nil {
+		return nil, err
+	}
+
+	if !record.visible(asOf) {
+		return nil, nil
+	}
+
+	return &store.GraphItem{
+		GraphItemType: string(t),
+		K1:            append([]byte{}, k1...),
+		K2:            append([]byte{}, k2...),
+		Encoding:      record.Encoding,
+		GraphItemData: record.GraphItemData,
+	}, nil
+}
+
+// getBoltNodes returns the nodes identified by key visible as of asOf.
+func getBoltNodes(tx *bolt.Tx, key []byte, asOf *time.Time) ([]*store.GraphItem, error) {
+	nodes := make([]*store.GraphItem, 0)
+
+	prefix := boltKey(key, key)
+	cursor := tx.Bucket(itemsBucket).Cursor()
+
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		parts := splitBoltKey(k)
+
+		node, err := getBoltItemAsOf(tx, parts[0], parts[1], parts[2], asOf)
+		if err != nil {
+			return nil, err
+		} else if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// findBoltPairs scans the provided index for edges adjacent to key, pairing
+// each edge with the node on the opposite end. Only items visible as of asOf
+// are returned.
+func findBoltPairs(tx *bolt.Tx, key []byte, edgeTypes []string, downstream bool, asOf *time.Time) ([]*store.GraphItemPair, error) {
+	wanted := make(map[string]bool, len(edgeTypes))
+	for _, edgeType := range edgeTypes {
+		wanted[edgeType] = true
+	}
+
+	bucket := itemsBucket
+	if downstream {
+		bucket = reverseBucket
+	}
+
+	pairs := make([]*store.GraphItemPair, 0)
+
+	prefix := boltKey(key)
+	cursor := tx.Bucket(bucket).Cursor()
+
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		parts := splitBoltKey(k)
+		near, far, t := parts[0], parts[1], parts[2]
+
+		if !wanted[string(t)] || bytes.Equal(near, far) {
+			continue
+		}
+
+		k1, k2 := near, far
+		if downstream {
+			k1, k2 = far, near
+		}
+
+		edge, err := getBoltItemAsOf(tx, k1, k2, t, asOf)
+		if err != nil {
+			return nil, err
+		} else if edge == nil {
+			continue
+		}
+
+		nodes, err := getBoltNodes(tx, far, asOf)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			pairs = append(pairs, &store.GraphItemPair{
+				Edge: edge,
+				Node: node,
+			})
+		}
+	}
+
+	return pairs, nil
+}
+
+func (gs *boltGraphStore) find(ctx context.Context, key []byte, edgeTypes []string, downstream bool) (*store.FindResponse, error) {
+	asOf := AsOf(ctx)
+
+	var pairs []*store.GraphItemPair
+
+	err := gs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		pairs, err = findBoltPairs(tx, key, edgeTypes, downstream, asOf)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.FindResponse{
+		Pairs: pairs,
+	}, nil
+}
+
+func (gs *boltGraphStore) FindUpstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
+	return gs.find(ctx, req.GetKey(), req.GetEdgeTypes(), false)
+}
+
+func (gs *boltGraphStore) FindDownstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
+	return gs.find(ctx, req.GetKey(), req.GetEdgeTypes(), true)
+}
+
+// traverse walks the graph breadth first within a single read transaction.
+func (gs *boltGraphStore) traverse(ctx context.Context, req *TraverseRequest, downstream bool) (*TraverseResponse, error) {
+	asOf := AsOf(ctx)
+
+	pairs := make([]*TraversedPair, 0)
+
+	err := gs.db.View(func(tx *bolt.Tx) error {
+		visited := map[string]bool{string(req.Key): true}
+		frontier := [][]byte{req.Key}
+
+		for depth := 1; len(frontier) > 0 && (req.MaxDepth <= 0 || depth <= req.MaxDepth); depth++ {
+			next := make([][]byte, 0)
+
+			for _, key := range frontier {
+				found, err := findBoltPairs(tx, key, req.EdgeTypes, downstream, asOf)
+				if err != nil {
+					return err
+				}
+
+				for _, pair := range found {
+					pairs = append(pairs, &TraversedPair{
+						Edge:  pair.GetEdge(),
+						Node:  pair.GetNode(),
+						Depth: depth,
+					})
+
+					node := pair.GetNode().GetK1()
+					if !visited[string(node)] {
+						visited[string(node)] = true
+						next = append(next, node)
+					}
+				}
+			}
+
+			frontier = next
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TraverseResponse{
+		Pairs: pairs,
+	}, nil
+}
+
+func (gs *boltGraphStore) TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	return gs.traverse(ctx, req, false)
+}
+
+func (gs *boltGraphStore) TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	return gs.traverse(ctx, req, true)
+}
@@ -0,0 +1,141 @@
+package graphstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/stretchr/testify/require"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNewBoltGraphStore(t *testing.T) {
+	data := []*store.GraphItem{
+		{GraphItemType: "node", K1: k1, K2: k1, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k2, K2: k2, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k3, K2: k3, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k4, K2: k4, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k5, K2: k5, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k6, K2: k6, Encoding: 0, GraphItemData: generateData()},
+
+		{GraphItemType: "edge", K1: k1, K2: k2, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k2, K2: k3, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k2, K2: k4, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k3, K2: k5, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k4, K2: k6, Encoding: 0, GraphItemData: generateData()},
+	}
+
+	dir, err := ioutil.TempDir("", "tracker")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tracker.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.Nil(t, err)
+
+	graphStore, err := graphstore.NewBoltGraphStore(db)
+	require.Nil(t, err)
+
+	_, err = graphStore.Put(nil, &store.PutRequest{
+		Items: data,
+	})
+	require.Nil(t, err)
+
+	// reopen the database to ensure the data was persisted
+	require.Nil(t, db.Close())
+
+	db, err = bolt.Open(path, 0600, nil)
+	require.Nil(t, err)
+	defer db.Close()
+
+	graphStore, err = graphstore.NewBoltGraphStore(db)
+	require.Nil(t, err)
+
+	response, err := graphStore.List(nil, &store.ListRequest{
+		Page:  1,
+		Count: 10,
+		Type:  "edge",
+	})
+	require.Nil(t, err)
+	require.Len(t, response.Items, 5)
+
+	downstream, err := graphStore.FindDownstream(nil, &store.FindRequest{
+		Key:       k2,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+
+	upstream, err := graphStore.FindUpstream(nil, &store.FindRequest{
+		Key:       k2,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+
+	require.Len(t, downstream.Pairs, 1)
+	require.Len(t, upstream.Pairs, 2)
+
+	require.Equal(t, downstream.Pairs[0].Node.K1, k1)
+	require.Equal(t, downstream.Pairs[0].Edge.K1, k1)
+	require.Equal(t, downstream.Pairs[0].Edge.K2, k2)
+
+	require.Equal(t, upstream.Pairs[0].Node.K1, k3)
+	require.Equal(t, upstream.Pairs[0].Edge.K1, k2)
+	require.Equal(t, upstream.Pairs[0].Edge.K2, k3)
+
+	require.Equal(t, upstream.Pairs[1].Node.K1, k4)
+	require.Equal(t, upstream.Pairs[1].Edge.K1, k2)
+	require.Equal(t, upstream.Pairs[1].Edge.K2, k4)
+
+	traversal, err := graphStore.(graphstore.Traverser).TraverseUpstream(nil, &graphstore.TraverseRequest{
+		Key:       k1,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+	require.Len(t, traversal.Pairs, 5)
+	require.Equal(t, 1, traversal.Pairs[0].Depth)
+	require.Equal(t, 3, traversal.Pairs[4].Depth)
+
+	_, err = graphStore.Delete(nil, &store.DeleteRequest{
+		Items: data[6:7],
+	})
+	require.Nil(t, err)
+
+	upstream, err = graphStore.FindUpstream(nil, &store.FindRequest{
+		Key:       k1,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+	require.Len(t, upstream.Pairs, 0)
+
+	response, err = graphStore.List(nil, &store.ListRequest{
+		Page:  1,
+		Count: 10,
+		Type:  "edge",
+	})
+	require.Nil(t, err)
+	require.Len(t, response.Items, 4)
+}
+
+// newTestBoltGraphStore opens a bolt graph store in a temporary directory,
+// returning a function that closes and removes it.
+func newTestBoltGraphStore(t *testing.T) (store.GraphStoreServer, func()) {
+	dir, err := ioutil.TempDir("", "tracker")
+	require.Nil(t, err)
+
+	db, err := bolt.Open(filepath.Join(dir, "tracker.db"), 0600, nil)
+	require.Nil(t, err)
+
+	graphStore, err := graphstore.NewBoltGraphStore(db)
+	require.Nil(t, err)
+
+	return graphStore, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,389 @@
+package graphstore
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+)
+
+// CacheStats counts the lookups made through a CachingGraphStoreClient.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// CachingGraphStoreClient decorates a store.GraphStoreClient with a read
+// through cache of FindUpstream, FindDownstream, List, and Scan responses. Entries
+// are evicted once they expire or when the cache is full, least recently used
+// first. Writes made through the client invalidate the entries they affect.
+// Writes made by other clients are only observed once entries expire, as are
+// nodes written after the edges pointing to them.
+//
+// Responses are shared between callers and must not be modified. Point in time
+// lookups bypass the cache, as do the other extensions in this package, which
+// are forwarded to the underlying client when it supports them.
+type CachingGraphStoreClient struct {
+	store.GraphStoreClient
+
+	// accessed atomically
+	hits   int64
+	misses int64
+
+	size int
+	ttl  time.Duration
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	// dependents maps the parts of the graph an entry was read from to the
+	// keys of the entries
+	dependents map[string]map[string]bool
+	// epoch changes with every invalidation so that responses read before a
+	// write are not cached after it
+	epoch uint64
+}
+
+type cacheEntry struct {
+	key          string
+	value        interface{}
+	expires      time.Time
+	dependencies []string
+}
+
+// NewCachingGraphStoreClient caches up to size responses of the client for at
+// most ttl each.
+func NewCachingGraphStoreClient(client store.GraphStoreClient, size int, ttl time.Duration) *CachingGraphStoreClient {
+	return &CachingGraphStoreClient{
+		GraphStoreClient: client,
+		size:             size,
+		ttl:              ttl,
+		lru:              list.New(),
+		entries:          make(map[string]*list.Element),
+		dependents:       make(map[string]map[string]bool),
+	}
+}
+
+var _ store.GraphStoreClient = &CachingGraphStoreClient{}
+var _ Traverser = &CachingGraphStoreClient{}
+var _ Applier = &CachingGraphStoreClient{}
+var _ Compactor = &CachingGraphStoreClient{}
+var _ Scanner = &CachingGraphStoreClient{}
+var _ Searcher = &CachingGraphStoreClient{}
+
+// Stats returns the number of lookups answered from the cache, the number
+// forwarded to the underlying client, and the number of cached responses.
+func (c *CachingGraphStoreClient) Stats() CacheStats {
+	c.lock.Lock()
+	entries := c.lru.Len()
+	c.lock.Unlock()
+
+	return CacheStats{
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// RunCacheStats logs the statistics of the cache every interval until the
+// context is done.
+func RunCacheStats(ctx context.Context, client *CachingGraphStoreClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := client.Stats()
+		logrus.Infof("[graphstore] cache: hits=%d misses=%d entries=%d", stats.Hits, stats.Misses, stats.Entries)
+	}
+}
+
+// cacheKey joins the parts unambiguously, since graph keys are arbitrary bytes.
+func cacheKey(parts ...string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = strconv.Quote(part)
+	}
+	return strings.Join(quoted, "/")
+}
+
+// cacheable reports whether the request reads the current graph.
+func cacheable(ctx context.Context) bool {
+	return AsOf(ctx) == nil
+}
+
+// lookup returns the cached response for the key along with the epoch that a
+// response read on a miss must be stored with.
+func (c *CachingGraphStoreClient) lookup(key string) (interface{}, uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(element)
+			atomic.AddInt64(&c.hits, 1)
+			return entry.value, c.epoch, true
+		}
+		c.remove(element)
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	return nil, c.epoch, false
+}
+
+// store caches the response unless the graph was written since it was read.
+func (c *CachingGraphStoreClient) store(key string, value interface{}, epoch uint64, dependencies []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if epoch != c.epoch || c.size <= 0 {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:          key,
+		value:        value,
+		expires:      time.Now().Add(c.ttl),
+		dependencies: dependencies,
+	})
+
+	for _, dependency := range dependencies {
+		if c.dependents[dependency] == nil {
+			c.dependents[dependency] = make(map[string]bool)
+		}
+		c.dependents[dependency][key] = true
+	}
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the entry, assuming the lock is held.
+func (c *CachingGraphStoreClient) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+
+	for _, dependency := range entry.dependencies {
+		delete(c.dependents[dependency], entry.key)
+		if len(c.dependents[dependency]) == 0 {
+			delete(c.dependents, dependency)
+		}
+	}
+}
+
+// invalidate drops every entry read from the parts of the graph the items are
+// stored in. Lists of the item types are dropped, as are lookups along edges
+// and lookups that returned nodes.
+func (c *CachingGraphStoreClient) invalidate(items ...[]*store.GraphItem) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.epoch++
+
+	for _, group := range items {
+		for _, item := range group {
+			dependencies := []string{cacheKey("list", item.GetGraphItemType())}
+			if string(item.GetK1()) == string(item.GetK2()) {
+				dependencies = append(dependencies, cacheKey("node", string(item.GetK1())))
+			} else {
+				dependencies = append(dependencies,
+					cacheKey("upstream", string(item.GetK1())),
+					cacheKey("downstream", string(item.GetK2())))
+			}
+
+			for _, dependency := range dependencies {
+				for key := range c.dependents[dependency] {
+					c.remove(c.entries[key])
+				}
+			}
+		}
+	}
+}
+
+// purge drops every entry.
+func (c *CachingGraphStoreClient) purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.epoch++
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.dependents = make(map[string]map[string]bool)
+}
+
+// Put writes the items and invalidates the entries they affect.
+func (c *CachingGraphStoreClient) Put(ctx context.Context, in *store.PutRequest, opts ...grpc.CallOption) (*store.PutResponse, error) {
+	resp, err := c.GraphStoreClient.Put(ctx, in, opts...)
+	c.invalidate(in.GetItems())
+	return resp, err
+}
+
+// Delete removes the items and invalidates the entries they affect.
+func (c *CachingGraphStoreClient) Delete(ctx context.Context, in *store.DeleteRequest, opts ...grpc.CallOption) (*store.DeleteResponse, error) {
+	resp, err := c.GraphStoreClient.Delete(ctx, in, opts...)
+	c.invalidate(in.GetItems())
+	return resp, err
+}
+
+// List returns a page of items of a type, caching the page.
+func (c *CachingGraphStoreClient) List(ctx context.Context, in *store.ListRequest, opts ...grpc.CallOption) (*store.ListResponse, error) {
+	if !cacheable(ctx) {
+		return c.GraphStoreClient.List(ctx, in, opts...)
+	}
+
+	key := cacheKey("list", in.GetType(), strconv.Itoa(int(in.GetPage())), strconv.Itoa(int(in.GetCount())))
+	value, epoch, ok := c.lookup(key)
+	if ok {
+		return value.(*store.ListResponse), nil
+	}
+
+	resp, err := c.GraphStoreClient.List(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(key, resp, epoch, []string{cacheKey("list", in.GetType())})
+	return resp, nil
+}
+
+// FindUpstream returns the nodes the key points to, caching the pairs.
+func (c *CachingGraphStoreClient) FindUpstream(ctx context.Context, in *store.FindRequest, opts ...grpc.CallOption) (*store.FindResponse, error) {
+	return c.find(ctx, "upstream", in, c.GraphStoreClient.FindUpstream, opts)
+}
+
+// FindDownstream returns the nodes pointing to the key, caching the pairs.
+func (c *CachingGraphStoreClient) FindDownstream(ctx context.Context, in *store.FindRequest, opts ...grpc.CallOption) (*store.FindResponse, error) {
+	return c.find(ctx, "downstream", in, c.GraphStoreClient.FindDownstream, opts)
+}
+
+type findFunc func(ctx context.Context, in *store.FindRequest, opts ...grpc.CallOption) (*store.FindResponse, error)
+
+func (c *CachingGraphStoreClient) find(ctx context.Context, direction string, in *store.FindRequest, find findFunc, opts []grpc.CallOption) (*store.FindResponse, error) {
+	if !cacheable(ctx) {
+		return find(ctx, in, opts...)
+	}
+
+	key := cacheKey(append([]string{direction, string(in.GetKey())}, in.GetEdgeTypes()...)...)
+	value, epoch, ok := c.lookup(key)
+	if ok {
+		return value.(*store.FindResponse), nil
+	}
+
+	resp, err := find(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries are invalidated by writes of the edges they were read along and
+	// of the nodes they returned
+	dependencies := []string{cacheKey(direction, string(in.GetKey()))}
+	for _, pair := range resp.GetPairs() {
+		dependencies = append(dependencies, cacheKey("node", string(pair.GetNode().GetK1())))
+	}
+
+	c.store(key, resp, epoch, dependencies)
+	return resp, nil
+}
+
+// TraverseUpstream forwards the traversal without caching it.
+func (c *CachingGraphStoreClient) TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	if traverser, ok := c.GraphStoreClient.(Traverser); ok {
+		return traverser.TraverseUpstream(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+// TraverseDownstream forwards the traversal without caching it.
+func (c *CachingGraphStoreClient) TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	if traverser, ok := c.GraphStoreClient.(Traverser); ok {
+		return traverser.TraverseDownstream(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+// Apply forwards the mutation and invalidates the entries it affects.
+func (c *CachingGraphStoreClient) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	applier, ok := c.GraphStoreClient.(Applier)
+	if !ok {
+		return nil, api.ErrUnimplemented
+	}
+
+	resp, err := applier.Apply(ctx, req)
+	c.invalidate(req.Deletes, req.Puts)
+	return resp, err
+}
+
+// Compact forwards the compaction and drops every entry, since the orphans it
+// deletes are not known up front.
+func (c *CachingGraphStoreClient) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	compactor, ok := c.GraphStoreClient.(Compactor)
+	if !ok {
+		return nil, api.ErrUnimplemented
+	}
+
+	resp, err := compactor.Compact(ctx, req)
+	c.purge()
+	return resp, err
+}
+
+// Scan returns a page of items of a type, caching the page.
+func (c *CachingGraphStoreClient) Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error) {
+	scanner, ok := c.GraphStoreClient.(Scanner)
+	if !ok {
+		return nil, api.ErrUnimplemented
+	}
+
+	if !cacheable(ctx) {
+		return scanner.Scan(ctx, req)
+	}
+
+	parts := []string{"scan", req.Type, strconv.Itoa(int(req.Count)), req.Token}
+	for _, filter := range req.Filters {
+		parts = append(parts, filter.Field, filter.Value, strconv.FormatBool(filter.Prefix))
+	}
+
+	key := cacheKey(parts...)
+	value, epoch, ok := c.lookup(key)
+	if ok {
+		return value.(*ScanResponse), nil
+	}
+
+	resp, err := scanner.Scan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// scans are invalidated along with lists of the type
+	c.store(key, resp, epoch, []string{cacheKey("list", req.Type)})
+	return resp, nil
+}
+
+// Search forwards the search without caching it.
+func (c *CachingGraphStoreClient) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	if searcher, ok := c.GraphStoreClient.(Searcher); ok {
+		return searcher.Search(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
@@ -0,0 +1,141 @@
+package graphstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingGraphStoreClient(t *testing.T) {
+	ctx := context.Background()
+	client := graphstore.NewCachingGraphStoreClient(
+		graphstore.NewInProcessGraphStoreClient(graphstore.NewMemoryGraphStore()), 10, time.Minute)
+
+	_, err := client.Put(ctx, &store.PutRequest{Items: []*store.GraphItem{
+		{GraphItemType: "node", K1: k1, K2: k1, GraphItemData: []byte("{}")},
+		{GraphItemType: "node", K1: k2, K2: k2, GraphItemData: []byte("{}")},
+		{GraphItemType: "node", K1: k3, K2: k3, GraphItemData: []byte("{}")},
+		{GraphItemType: "edge", K1: k1, K2: k2, GraphItemData: []byte("{}")},
+	}})
+	require.Nil(t, err)
+
+	findUpstream := func() *store.FindResponse {
+		resp, err := client.FindUpstream(ctx, &store.FindRequest{Key: k1, EdgeTypes: []string{"edge"}})
+		require.Nil(t, err)
+		return resp
+	}
+
+	// the second lookup is answered by the cache
+	require.Len(t, findUpstream().Pairs, 1)
+	require.Len(t, findUpstream().Pairs, 1)
+	require.Equal(t, graphstore.CacheStats{Hits: 1, Misses: 1, Entries: 1}, client.Stats())
+
+	// new edges invalidate lookups along them
+	_, err = client.Put(ctx, &store.PutRequest{Items: []*store.GraphItem{
+		{GraphItemType: "edge", K1: k1, K2: k3, GraphItemData: []byte("{}")},
+	}})
+	require.Nil(t, err)
+	require.Len(t, findUpstream().Pairs, 2)
+	require.Equal(t, int64(2), client.Stats().Misses)
+
+	// updated nodes invalidate the lookups that returned them
+	_, err = client.Put(ctx, &store.PutRequest{Items: []*store.GraphItem{
+		{GraphItemType: "node", K1: k3, K2: k3, GraphItemData: []byte(`{"updated":true}`)},
+	}})
+	require.Nil(t, err)
+
+	for _, pair := range findUpstream().Pairs {
+		if string(pair.Node.K1) == string(k3) {
+			require.Equal(t, `{"updated":true}`, string(pair.Node.GraphItemData))
+		}
+	}
+	require.Equal(t, int64(3), client.Stats().Misses)
+
+	// deletes and applies invalidate lookups and lists
+	list, err := client.List(ctx, &store.ListRequest{Type: "node", Count: 10})
+	require.Nil(t, err)
+	require.Len(t, list.Items, 3)
+
+	_, err = client.Delete(ctx, &store.DeleteRequest{Items: []*store.GraphItem{
+		{GraphItemType: "node", K1: k3, K2: k3},
+	}})
+	require.Nil(t, err)
+	require.Len(t, findUpstream().Pairs, 1)
+
+	list, err = client.List(ctx, &store.ListRequest{Type: "node", Count: 10})
+	require.Nil(t, err)
+	require.Len(t, list.Items, 2)
+
+	_, err = client.Apply(ctx, &graphstore.ApplyRequest{
+		Deletes: []*store.GraphItem{{GraphItemType: "edge", K1: k1, K2: k2}},
+	})
+	require.Nil(t, err)
+	require.Len(t, findUpstream().Pairs, 0)
+
+	// point in time lookups bypass the cache
+	stats := client.Stats()
+	_, err = client.FindUpstream(graphstore.WithAsOf(ctx, time.Now()), &store.FindRequest{Key: k1, EdgeTypes: []string{"edge"}})
+	require.Nil(t, err)
+	require.Equal(t, stats, client.Stats())
+
+	// extensions are forwarded
+	traversal, err := client.TraverseDownstream(ctx, &graphstore.TraverseRequest{Key: k3, EdgeTypes: []string{"edge"}})
+	require.Nil(t, err)
+	require.Len(t, traversal.Pairs, 1)
+
+	// scans are cached like lists
+	scan := func() *graphstore.ScanResponse {
+		resp, err := client.Scan(ctx, &graphstore.ScanRequest{Type: "node", Count: 10})
+		require.Nil(t, err)
+		return resp
+	}
+
+	require.Len(t, scan().Items, 2)
+	stats = client.Stats()
+	require.Len(t, scan().Items, 2)
+	require.Equal(t, stats.Hits+1, client.Stats().Hits)
+
+	_, err = client.Put(ctx, &store.PutRequest{Items: []*store.GraphItem{
+		{GraphItemType: "node", K1: k3, K2: k3, GraphItemData: []byte("{}")},
+	}})
+	require.Nil(t, err)
+	require.Len(t, scan().Items, 3)
+
+	// compactions drop every entry, including the scan of the orphaned k2
+	_, err = client.Compact(ctx, &graphstore.CompactRequest{NodeTypes: []string{"node"}})
+	require.Nil(t, err)
+	require.Equal(t, 0, client.Stats().Entries)
+	require.Len(t, scan().Items, 2)
+}
+
+func TestCachingGraphStoreClient_eviction(t *testing.T) {
+	ctx := context.Background()
+	client := graphstore.NewCachingGraphStoreClient(
+		graphstore.NewInProcessGraphStoreClient(graphstore.NewMemoryGraphStore()), 2, 50*time.Millisecond)
+
+	list := func(graphItemType string) {
+		_, err := client.List(ctx, &store.ListRequest{Type: graphItemType})
+		require.Nil(t, err)
+	}
+
+	list("a")
+	list("b")
+	list("a")
+	list("c")
+	require.Equal(t, graphstore.CacheStats{Hits: 1, Misses: 3, Entries: 2}, client.Stats())
+
+	// b was the least recently used
+	list("a")
+	list("b")
+	require.Equal(t, graphstore.CacheStats{Hits: 2, Misses: 4, Entries: 2}, client.Stats())
+
+	// expired entries are read again
+	time.Sleep(100 * time.Millisecond)
+	list("b")
+	require.Equal(t, graphstore.CacheStats{Hits: 2, Misses: 5, Entries: 2}, client.Stats())
+}
@@ -0,0 +1,144 @@
+package graphstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/deps-cloud/api"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CompactRequest describes the garbage to collect from the graph. Rows deleted
+// before DeletedBefore are removed for good, which also removes them from point
+// in time queries. A zero DeletedBefore keeps every deleted row. Nodes of the provided NodeTypes
+// that no longer have any live edges in either direction are deleted.
+type CompactRequest struct {
+	DeletedBefore time.Time
+	NodeTypes     []string
+}
+
+// CompactResponse reports the amount of garbage that was collected.
+type CompactResponse struct {
+	// Orphaned is the number of nodes that were deleted for having no edges
+	Orphaned int64
+	// Purged is the number of deleted rows that were removed
+	Purged int64
+}
+
+// Compactor is implemented by graph stores that can collect garbage left
+// behind by soft deletes.
+type Compactor interface {
+	Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error)
+}
+
+var _ Compactor = &graphStore{}
+
+func (gs *graphStore) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	if gs.rwdb == nil {
+		return nil, api.ErrUnsupported
+	}
+
+	if len(gs.statements.DeleteOrphanedGraphData) == 0 || len(gs.statements.PurgeGraphData) == 0 {
+		return nil, api.ErrUnimplemented
+	}
+
+	resp := &CompactResponse{}
+
+	// orphans are deleted first so they can be purged by a later compaction
+	if len(req.NodeTypes) > 0 {
+		orphaned, err := gs.exec(ctx, gs.statements.DeleteOrphanedGraphData, map[string]interface{}{
+			"date_deleted": time.Now(),
+			"node_types":   req.NodeTypes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Orphaned = orphaned
+	}
+
+	if !req.DeletedBefore.IsZero() {
+		purged, err := gs.exec(ctx, gs.statements.PurgeGraphData, map[string]interface{}{
+			"deleted_before": req.DeletedBefore,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Purged = purged
+	}
+
+	// search trigrams of nodes that are no longer live are not needed
+	if len(gs.statements.PurgeGraphSearch) > 0 {
+		if _, err := gs.exec(ctx, gs.statements.PurgeGraphSearch, map[string]interface{}{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// exec runs a named statement that may contain IN clauses against the
+// read-write database, returning the number of affected rows.
+func (gs *graphStore) exec(ctx context.Context, statement string, arg map[string]interface{}) (int64, error) {
+	query, args, err := sqlx.Named(statement, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	result, err := gs.rwdb.ExecContext(queryCtx, gs.rwdb.Rebind(query), args...)
+	if err != nil {
+		return 0, queryError(queryCtx, err)
+	}
+
+	return result.RowsAffected()
+}
+
+// DeletedBefore returns the time rows must have been deleted before to be
+// purged given their retention, or the zero time when retention is 0 and
+// deleted rows are kept for point in time queries.
+func DeletedBefore(retention time.Duration) time.Time {
+	if retention <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-retention)
+}
+
+// RunCompactor compacts the graph every interval until the context is done.
+// Rows are purged once they have been deleted for longer than retention.
+func RunCompactor(ctx context.Context, compactor Compactor, interval, retention time.Duration, nodeTypes []string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		resp, err := compactor.Compact(ctx, &CompactRequest{
+			DeletedBefore: DeletedBefore(retention),
+			NodeTypes:     nodeTypes,
+		})
+
+		if err == api.ErrUnsupported || err == api.ErrUnimplemented {
+			logrus.Infof("[graphstore] compaction is not supported by the graph store, stopping compactor")
+			return
+		} else if err != nil {
+			logrus.Errorf("[graphstore] failed to compact the graph: %v", err)
+			continue
+		}
+
+		logrus.Infof("[graphstore] compacted the graph: orphaned=%d purged=%d", resp.Orphaned, resp.Purged)
+	}
+}
@@ -0,0 +1,70 @@
+package graphstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// initialConnectBackoff is how long Connect waits after the first failed ping
+	initialConnectBackoff = 100 * time.Millisecond
+	// maxConnectBackoff caps how long Connect waits between pings
+	maxConnectBackoff = 5 * time.Second
+)
+
+// PoolOptions tune the connection pool of a database. Zero values keep the
+// defaults of database/sql.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Connect opens the database, configures its connection pool, and pings it
+// until it responds. Failed pings are retried with an exponential backoff so
+// that the database may come up after the tracker. Connect gives up once the
+// context is done.
+func Connect(ctx context.Context, driver, address string, pool *PoolOptions) (*sqlx.DB, error) {
+	db, err := sqlx.Open(driver, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool != nil {
+		if pool.MaxOpenConns != 0 {
+			db.SetMaxOpenConns(pool.MaxOpenConns)
+		}
+		if pool.MaxIdleConns != 0 {
+			db.SetMaxIdleConns(pool.MaxIdleConns)
+		}
+		if pool.ConnMaxLifetime != 0 {
+			db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+		}
+	}
+
+	backoff := initialConnectBackoff
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return db, nil
+		}
+
+		logrus.Warnf("[graphstore] database is unreachable, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			_ = db.Close()
+			return nil, fmt.Errorf("database is unreachable: %v", err)
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package graphstore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/stretchr/testify/require"
+)
+
+// unavailableDriver refuses connections until enough attempts were made,
+// like a database that comes up after the tracker.
+type unavailableDriver struct {
+	attempts  int32
+	available int32
+}
+
+func (d *unavailableDriver) Open(name string) (driver.Conn, error) {
+	if atomic.AddInt32(&d.attempts, 1) <= d.available {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return (&sqlite3.SQLiteDriver{}).Open(name)
+}
+
+func TestConnect(t *testing.T) {
+	unavailable := &unavailableDriver{available: 2}
+	sql.Register("sqlite3_unavailable", unavailable)
+
+	db, err := graphstore.Connect(context.Background(), "sqlite3_unavailable", "file:TestConnect?mode=memory&cache=shared", &graphstore.PoolOptions{
+		MaxOpenConns: 4,
+	})
+	require.Nil(t, err)
+	defer db.Close()
+
+	require.Equal(t, int32(3), atomic.LoadInt32(&unavailable.attempts))
+	require.Equal(t, 4, db.Stats().MaxOpenConnections)
+
+	_, err = graphstore.NewSQLGraphStore(db, db, graphstore.DefaultStatements())
+	require.Nil(t, err)
+}
+
+func TestConnect_unreachable(t *testing.T) {
+	unavailable := &unavailableDriver{available: 1 << 30}
+	sql.Register("sqlite3_unreachable", unavailable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := graphstore.Connect(ctx, "sqlite3_unreachable", "file:TestConnect_unreachable?mode=memory&cache=shared", nil)
+	require.NotNil(t, err)
+	require.True(t, atomic.LoadInt32(&unavailable.attempts) > 1)
+}
@@ -0,0 +1,94 @@
+package graphstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ItemError describes why a single item in a write could not be applied.
+// Field names the list of items within the request and Index is the position
+// of the item within that list.
+type ItemError struct {
+	Field string
+	Index int
+	Item  *store.GraphItem
+	Err   error
+}
+
+// Path identifies the item within the request, e.g. items[3]
+func (e *ItemError) Path() string {
+	return fmt.Sprintf("%s[%d]", e.Field, e.Index)
+}
+
+// Error describes the item and why it failed
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s (%s %s %s): %v", e.Path(), e.Item.GetGraphItemType(),
+		Base64encode(e.Item.GetK1()), Base64encode(e.Item.GetK2()), e.Err)
+}
+
+// newWriteError reports that a write was aborted without applying any of its
+// items. The returned status uses codes.Aborted since the write can be retried
+// once the failed items are addressed. Each failure is attached as a
+// BadRequest field violation so callers can identify the items.
+func newWriteError(action string, failures []*ItemError) error {
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Field != failures[j].Field {
+			return failures[i].Field < failures[j].Field
+		}
+		return failures[i].Index < failures[j].Index
+	})
+
+	messages := make([]string, len(failures))
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(failures))
+
+	for i, failure := range failures {
+		messages[i] = failure.Error()
+		violations[i] = &errdetails.BadRequest_FieldViolation{
+			Field:       failure.Path(),
+			Description: failure.Err.Error(),
+		}
+	}
+
+	st := status.New(codes.Aborted, fmt.Sprintf("failed to %s %d items, no changes were made: %s",
+		action, len(failures), strings.Join(messages, "; ")))
+
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+// FailedItems returns the reason each item caused a write to be aborted keyed
+// by the path of the item within the request, e.g. items[3]. It returns nil
+// for other errors.
+func FailedItems(err error) map[string]string {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Aborted {
+		return nil
+	}
+
+	var failed map[string]string
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+
+		for _, violation := range badRequest.GetFieldViolations() {
+			if failed == nil {
+				failed = make(map[string]string)
+			}
+			failed[violation.GetField()] = violation.GetDescription()
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,72 @@
+package graphstore
+
+import (
+	"context"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+)
+
+// NewInProcessGraphStoreClient behaves like store.NewInProcessGraphStoreClient
+// but also exposes the extensions in this package (Traverser, Applier,
+// Compactor, Scanner, and Searcher) when the underlying server supports them. Unsupported extensions
+// fail with api.ErrUnimplemented, just as they would over the wire.
+func NewInProcessGraphStoreClient(server store.GraphStoreServer) store.GraphStoreClient {
+	return &inProcessGraphStoreClient{
+		GraphStoreClient: store.NewInProcessGraphStoreClient(server),
+		server:           server,
+	}
+}
+
+type inProcessGraphStoreClient struct {
+	store.GraphStoreClient
+	server store.GraphStoreServer
+}
+
+var _ Traverser = &inProcessGraphStoreClient{}
+var _ Applier = &inProcessGraphStoreClient{}
+var _ Compactor = &inProcessGraphStoreClient{}
+var _ Scanner = &inProcessGraphStoreClient{}
+var _ Searcher = &inProcessGraphStoreClient{}
+
+func (c *inProcessGraphStoreClient) TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	if traverser, ok := c.server.(Traverser); ok {
+		return traverser.TraverseUpstream(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+func (c *inProcessGraphStoreClient) TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	if traverser, ok := c.server.(Traverser); ok {
+		return traverser.TraverseDownstream(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+func (c *inProcessGraphStoreClient) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	if applier, ok := c.server.(Applier); ok {
+		return applier.Apply(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+func (c *inProcessGraphStoreClient) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	if compactor, ok := c.server.(Compactor); ok {
+		return compactor.Compact(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+func (c *inProcessGraphStoreClient) Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error) {
+	if scanner, ok := c.server.(Scanner); ok {
+		return scanner.Scan(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
+
+func (c *inProcessGraphStoreClient) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	if searcher, ok := c.server.(Searcher); ok {
+		return searcher.Search(ctx, req)
+	}
+	return nil, api.ErrUnimplemented
+}
@@ -0,0 +1,480 @@
+package graphstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+)
+
+// memoryKey identifies a graph item within the memoryGraphStore
+type memoryKey struct {
+	graphItemType string
+	k1            string
+	k2            string
+}
+
+// memoryRecord holds a graph item alongside its bookkeeping
+type memoryRecord struct {
+	item         *store.GraphItem
+	lastModified time.Time
+	dateCreated  time.Time
+	dateDeleted  *time.Time
+}
+
+// NewMemoryGraphStore constructs a new GraphStore that holds the entire graph
+// in memory. Each call returns an independent graph, making it well suited for
+// tests and ephemeral deployments.
+func NewMemoryGraphStore() store.GraphStoreServer {
+	return &memoryGraphStore{
+		items:      make(map[memoryKey]*memoryRecord),
+		nodes:      make(map[string]map[memoryKey]bool),
+		upstream:   make(map[string]map[memoryKey]bool),
+		downstream: make(map[string]map[memoryKey]bool),
+	}
+}
+
+type memoryGraphStore struct {
+	lock  sync.RWMutex
+	items map[memoryKey]*memoryRecord
+	// nodes indexes items whose k1 and k2 match by their key
+	nodes map[string]map[memoryKey]bool
+	// upstream indexes edges by their k1
+	upstream map[string]map[memoryKey]bool
+	// downstream indexes edges by their k2
+	downstream map[string]map[memoryKey]bool
+}
+
+var _ store.GraphStoreServer = &memoryGraphStore{}
+var _ Traverser = &memoryGraphStore{}
+var _ Applier = &memoryGraphStore{}
+var _ Compactor = &memoryGraphStore{}
+var _ Scanner = &memoryGraphStore{}
+var _ Searcher = &memoryGraphStore{}
+
+func copyGraphItem(item *store.GraphItem) *store.GraphItem {
+	return &store.GraphItem{
+		GraphItemType: item.GetGraphItemType(),
+		K1:            append([]byte{}, item.GetK1()...),
+		K2:            append([]byte{}, item.GetK2()...),
+		Encoding:      item.GetEncoding(),
+		GraphItemData: append([]byte{}, item.GetGraphItemData()...),
+	}
+}
+
+func addToIndex(idx map[string]map[memoryKey]bool, key string, value memoryKey) {
+	if _, ok := idx[key]; !ok {
+		idx[key] = make(map[memoryKey]bool)
+	}
+	idx[key][value] = true
+}
+
+func removeFromIndex(idx map[string]map[memoryKey]bool, key string, value memoryKey) {
+	delete(idx[key], value)
+	if len(idx[key]) == 0 {
+		delete(idx, key)
+	}
+}
+
+// live returns the item identified by key if it exists and has not been deleted
+func (gs *memoryGraphStore) live(key memoryKey) *store.GraphItem {
+	return gs.visible(key, nil)
+}
+
+// visible returns the item identified by key if it existed at the provided
+// point in time, or if it currently exists when asOf is nil
+func (gs *memoryGraphStore) visible(key memoryKey, asOf *time.Time) *store.GraphItem {
+	record, ok := gs.items[key]
+	if !ok {
+		return nil
+	}
+
+	if asOf == nil {
+		if record.dateDeleted != nil {
+			return nil
+		}
+	} else if record.dateCreated.After(*asOf) || (record.dateDeleted != nil && !record.dateDeleted.After(*asOf)) {
+		return nil
+	}
+
+	return record.item
+}
+
+// sortedKeys returns the keys in the set ordered by k1, k2, and then type
+func sortedKeys(set map[memoryKey]bool) []memoryKey {
+	keys := make([]memoryKey, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].k1 != keys[j].k1 {
+			return keys[i].k1 < keys[j].k1
+		}
+		if keys[i].k2 != keys[j].k2 {
+			return keys[i].k2 < keys[j].k2
+		}
+		return keys[i].graphItemType < keys[j].graphItemType
+	})
+
+	return keys
+}
+
+// put stores the items, replacing any existing items with the same keys
+func (gs *memoryGraphStore) put(items []*store.GraphItem, timestamp time.Time) {
+	for _, item := range items {
+		key := memoryKey{
+			graphItemType: item.GetGraphItemType(),
+			k1:            string(item.GetK1()),
+			k2:            string(item.GetK2()),
+		}
+
+		created := timestamp
+		if existing, ok := gs.items[key]; ok && existing.dateDeleted == nil {
+			created = existing.dateCreated
+		}
+
+		gs.items[key] = &memoryRecord{
+			item:         copyGraphItem(item),
+			lastModified: timestamp,
+			dateCreated:  created,
+		}
+
+		if key.k1 == key.k2 {
+			addToIndex(gs.nodes, key.k1, key)
+		} else {
+			addToIndex(gs.upstream, key.k1, key)
+			addToIndex(gs.downstream, key.k2, key)
+		}
+	}
+}
+
+// delete marks the items as deleted
+func (gs *memoryGraphStore) delete(items []*store.GraphItem, timestamp time.Time) {
+	for _, item := range items {
+		key := memoryKey{
+			graphItemType: item.GetGraphItemType(),
+			k1:            string(item.GetK1()),
+			k2:            string(item.GetK2()),
+		}
+
+		if record, ok := gs.items[key]; ok {
+			record.dateDeleted = &timestamp
+		}
+	}
+}
+
+func (gs *memoryGraphStore) Put(ctx context.Context, req *store.PutRequest) (*store.PutResponse, error) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	gs.put(req.GetItems(), time.Now())
+
+	return &store.PutResponse{}, nil
+}
+
+func (gs *memoryGraphStore) Delete(ctx context.Context, req *store.DeleteRequest) (*store.DeleteResponse, error) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	gs.delete(req.GetItems(), time.Now())
+
+	return &store.DeleteResponse{}, nil
+}
+
+func (gs *memoryGraphStore) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	timestamp := time.Now()
+	gs.delete(req.Deletes, timestamp)
+	gs.put(req.Puts, timestamp)
+
+	return &ApplyResponse{}, nil
+}
+
+// hasLiveEdges reports whether any live edge starts or ends at key
+func (gs *memoryGraphStore) hasLiveEdges(key string) bool {
+	for _, idx := range []map[string]map[memoryKey]bool{gs.upstream, gs.downstream} {
+		for edgeKey := range idx[key] {
+			if gs.live(edgeKey) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (gs *memoryGraphStore) Compact(ctx context.Context, req *CompactRequest) (*CompactResponse, error) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	timestamp := time.Now()
+	resp := &CompactResponse{}
+
+	nodeTypes := make(map[string]bool, len(req.NodeTypes))
+	for _, nodeType := range req.NodeTypes {
+		nodeTypes[nodeType] = true
+	}
+
+	for key, record := range gs.items {
+		if key.k1 == key.k2 && nodeTypes[key.graphItemType] && record.dateDeleted == nil && !gs.hasLiveEdges(key.k1) {
+			record.dateDeleted = &timestamp
+			resp.Orphaned++
+		}
+	}
+
+	for key, record := range gs.items {
+		if record.dateDeleted == nil || !record.dateDeleted.Before(req.DeletedBefore) {
+			continue
+		}
+
+		delete(gs.items, key)
+		if key.k1 == key.k2 {
+			removeFromIndex(gs.nodes, key.k1, key)
+		} else {
+			removeFromIndex(gs.upstream, key.k1, key)
+			removeFromIndex(gs.downstream, key.k2, key)
+		}
+		resp.Purged++
+	}
+
+	return resp, nil
+}
+
+func (gs *memoryGraphStore) List(ctx context.Context, req *store.ListRequest) (*store.ListResponse, error) {
+	asOf := AsOf(ctx)
+
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	page := max(req.GetPage(), 1)
+
+	limit := ScanCount(req.GetCount())
+	offset := (page - 1) * limit
+
+	matching := make(map[memoryKey]bool)
+	for key := range gs.items {
+		if key.graphItemType == req.GetType() && gs.visible(key, asOf) != nil {
+			matching[key] = true
+		}
+	}
+
+	items := make([]*store.GraphItem, 0, limit)
+	for _, key := range sortedKeys(matching) {
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		if int32(len(items)) == limit {
+			break
+		}
+
+		items = append(items, copyGraphItem(gs.visible(key, asOf)))
+	}
+
+	return &store.ListResponse{
+		Items: items,
+	}, nil
+}
+
+func (gs *memoryGraphStore) Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error) {
+	asOf := AsOf(ctx)
+
+	if err := validateScanFilters(req.Filters); err != nil {
+		return nil, err
+	}
+
+	token, err := decodeScanToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	count := ScanCount(req.Count)
+	after := memoryKey{graphItemType: req.Type, k1: string(token.K1), k2: string(token.K2)}
+
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	total := int64(0)
+	matching := make(map[memoryKey]bool)
+	for key := range gs.items {
+		if key.graphItemType != req.Type {
+			continue
+		}
+
+		item := gs.visible(key, asOf)
+		if item == nil || !matchesScanFilters(item, req.Filters) {
+			continue
+		}
+
+		total++
+		if key.k1 > after.k1 || (key.k1 == after.k1 && key.k2 > after.k2) {
+			matching[key] = true
+		}
+	}
+
+	items := make([]*store.GraphItem, 0, count+1)
+	for _, key := range sortedKeys(matching) {
+		if int32(len(items)) > count {
+			break
+		}
+		items = append(items, copyGraphItem(gs.visible(key, asOf)))
+	}
+
+	return newScanResponse(items, count, total), nil
+}
+
+func (gs *memoryGraphStore) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	asOf := AsOf(ctx)
+
+	q, err := newSearchQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	dependentTypes := make(map[string]bool, len(req.DependentTypes))
+	for _, t := range req.DependentTypes {
+		dependentTypes[t] = true
+	}
+
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	results := make([]*SearchResult, 0)
+	for key := range gs.items {
+		if key.k1 != key.k2 {
+			continue
+		}
+
+		item := gs.visible(key, asOf)
+		if item == nil {
+			continue
+		}
+
+		score, ok := q.score(item)
+		if !ok {
+			continue
+		}
+
+		dependents := int64(0)
+		for edgeKey := range gs.downstream[key.k1] {
+			if dependentTypes[edgeKey.graphItemType] && gs.visible(edgeKey, asOf) != nil {
+				dependents++
+			}
+		}
+
+		results = append(results, &SearchResult{
+			Item:       copyGraphItem(item),
+			Dependents: dependents,
+			Score:      score,
+		})
+	}
+
+	return rankSearchResults(results, ScanCount(req.Count)), nil
+}
+
+// find pairs each visible edge adjacent to key with the visible nodes on its
+// far end
+func (gs *memoryGraphStore) find(key []byte, edgeTypes []string, downstream bool, asOf *time.Time) []*store.GraphItemPair {
+	wanted := make(map[string]bool, len(edgeTypes))
+	for _, edgeType := range edgeTypes {
+		wanted[edgeType] = true
+	}
+
+	idx := gs.upstream
+	if downstream {
+		idx = gs.downstream
+	}
+
+	pairs := make([]*store.GraphItemPair, 0)
+	for _, edgeKey := range sortedKeys(idx[string(key)]) {
+		edge := gs.visible(edgeKey, asOf)
+		if edge == nil || !wanted[edgeKey.graphItemType] {
+			continue
+		}
+
+		far := edgeKey.k2
+		if downstream {
+			far = edgeKey.k1
+		}
+
+		for _, nodeKey := range sortedKeys(gs.nodes[far]) {
+			if node := gs.visible(nodeKey, asOf); node != nil {
+				pairs = append(pairs, &store.GraphItemPair{
+					Edge: copyGraphItem(edge),
+					Node: copyGraphItem(node),
+				})
+			}
+		}
+	}
+
+	return pairs
+}
+
+func (gs *memoryGraphStore) findPairs(ctx context.Context, req *store.FindRequest, downstream bool) (*store.FindResponse, error) {
+	asOf := AsOf(ctx)
+
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	return &store.FindResponse{
+		Pairs: gs.find(req.GetKey(), req.GetEdgeTypes(), downstream, asOf),
+	}, nil
+}
+
+func (gs *memoryGraphStore) FindUpstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
+	return gs.findPairs(ctx, req, false)
+}
+
+func (gs *memoryGraphStore) FindDownstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
+	return gs.findPairs(ctx, req, true)
+}
+
+func (gs *memoryGraphStore) traverse(ctx context.Context, req *TraverseRequest, downstream bool) (*TraverseResponse, error) {
+	asOf := AsOf(ctx)
+
+	gs.lock.RLock()
+	defer gs.lock.RUnlock()
+
+	pairs := make([]*TraversedPair, 0)
+	visited := map[string]bool{string(req.Key): true}
+	frontier := [][]byte{req.Key}
+
+	for depth := 1; len(frontier) > 0 && (req.MaxDepth <= 0 || depth <= req.MaxDepth); depth++ {
+		next := make([][]byte, 0)
+
+		for _, key := range frontier {
+			for _, pair := range gs.find(key, req.EdgeTypes, downstream, asOf) {
+				pairs = append(pairs, &TraversedPair{
+					Edge:  pair.GetEdge(),
+					Node:  pair.GetNode(),
+					Depth: depth,
+				})
+
+				node := pair.GetNode().GetK1()
+				if !visited[string(node)] {
+					visited[string(node)] = true
+					next = append(next, node)
+				}
+			}
+		}
+
+		frontier = next
+	}
+
+	return &TraverseResponse{
+		Pairs: pairs,
+	}, nil
+}
+
+func (gs *memoryGraphStore) TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	return gs.traverse(ctx, req, false)
+}
+
+func (gs *memoryGraphStore) TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	return gs.traverse(ctx, req, true)
+}
@@ -0,0 +1,112 @@
+package graphstore_test
+
+import (
+	"testing"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMemoryGraphStore(t *testing.T) {
+	data := []*store.GraphItem{
+		{GraphItemType: "node", K1: k1, K2: k1, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k2, K2: k2, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k3, K2: k3, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k4, K2: k4, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k5, K2: k5, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "node", K1: k6, K2: k6, Encoding: 0, GraphItemData: generateData()},
+
+		{GraphItemType: "edge", K1: k1, K2: k2, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k2, K2: k3, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k2, K2: k4, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k3, K2: k5, Encoding: 0, GraphItemData: generateData()},
+		{GraphItemType: "edge", K1: k4, K2: k6, Encoding: 0, GraphItemData: generateData()},
+	}
+
+	graphStore := graphstore.NewMemoryGraphStore()
+
+	_, err := graphStore.Put(nil, &store.PutRequest{
+		Items: data,
+	})
+	require.Nil(t, err)
+
+	// stores are independent of one another
+	empty, err := graphstore.NewMemoryGraphStore().List(nil, &store.ListRequest{Type: "edge"})
+	require.Nil(t, err)
+	require.Len(t, empty.Items, 0)
+
+	response, err := graphStore.List(nil, &store.ListRequest{
+		Page:  1,
+		Count: 10,
+		Type:  "edge",
+	})
+	require.Nil(t, err)
+	require.Len(t, response.Items, 5)
+
+	downstream, err := graphStore.FindDownstream(nil, &store.FindRequest{
+		Key:       k2,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+
+	upstream, err := graphStore.FindUpstream(nil, &store.FindRequest{
+		Key:       k2,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+
+	require.Len(t, downstream.Pairs, 1)
+	require.Len(t, upstream.Pairs, 2)
+
+	require.Equal(t, downstream.Pairs[0].Node.K1, k1)
+	require.Equal(t, downstream.Pairs[0].Edge.K1, k1)
+	require.Equal(t, downstream.Pairs[0].Edge.K2, k2)
+
+	require.Equal(t, upstream.Pairs[0].Node.K1, k3)
+	require.Equal(t, upstream.Pairs[1].Node.K1, k4)
+
+	traversal, err := graphStore.(graphstore.Traverser).TraverseDownstream(nil, &graphstore.TraverseRequest{
+		Key:       k6,
+		EdgeTypes: []string{"edge"},
+		MaxDepth:  2,
+	})
+	require.Nil(t, err)
+	require.Len(t, traversal.Pairs, 2)
+	require.Equal(t, k4, traversal.Pairs[0].Node.K1)
+	require.Equal(t, k2, traversal.Pairs[1].Node.K1)
+
+	_, err = graphStore.Delete(nil, &store.DeleteRequest{
+		Items: data[6:7],
+	})
+	require.Nil(t, err)
+
+	upstream, err = graphStore.FindUpstream(nil, &store.FindRequest{
+		Key:       k1,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+	require.Len(t, upstream.Pairs, 0)
+
+	response, err = graphStore.List(nil, &store.ListRequest{
+		Page:  1,
+		Count: 10,
+		Type:  "edge",
+	})
+	require.Nil(t, err)
+	require.Len(t, response.Items, 4)
+
+	// putting an item again restores it
+	_, err = graphStore.Put(nil, &store.PutRequest{
+		Items: data[6:7],
+	})
+	require.Nil(t, err)
+
+	upstream, err = graphStore.FindUpstream(nil, &store.FindRequest{
+		Key:       k1,
+		EdgeTypes: []string{"edge"},
+	})
+	require.Nil(t, err)
+	require.Len(t, upstream.Pairs, 1)
+}
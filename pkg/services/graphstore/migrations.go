@@ -0,0 +1,160 @@
+package graphstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaVersion returns the version of the schema supported by the statements.
+func (s *Statements) SchemaVersion() int {
+	return len(s.Migrations)
+}
+
+// versioned reports whether the statements support versioned migrations.
+// Statement files written before migrations existed only create the table.
+func (s *Statements) versioned() bool {
+	return len(s.Migrations) > 0 &&
+		len(s.CreateSchemaVersionTable) > 0 &&
+		len(s.SelectSchemaVersion) > 0 &&
+		len(s.InsertSchemaVersion) > 0
+}
+
+// CurrentSchemaVersion returns the version of the schema applied to the
+// database. Databases that have never been migrated report version 0.
+func CurrentSchemaVersion(db *sqlx.DB, statements *Statements) (int, error) {
+	if !statements.versioned() {
+		return 0, nil
+	}
+
+	if _, err := db.Exec(statements.CreateSchemaVersionTable); err != nil {
+		return 0, err
+	}
+
+	return selectSchemaVersion(db, statements)
+}
+
+func selectSchemaVersion(db *sqlx.DB, statements *Statements) (int, error) {
+	var version sql.NullInt64
+	if err := db.Get(&version, statements.SelectSchemaVersion); err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// CheckSchemaVersion ensures the database does not use a newer schema than the
+// statements understand. Unlike Migrate, it never writes to the database, which
+// makes it safe to use against read-only replicas.
+func CheckSchemaVersion(db *sqlx.DB, statements *Statements) error {
+	if !statements.versioned() {
+		return nil
+	}
+
+	current, err := selectSchemaVersion(db, statements)
+	if err != nil {
+		logrus.Warnf("[graphstore] unable to determine the database schema version: %v", err)
+		return nil
+	}
+
+	if supported := statements.SchemaVersion(); current > supported {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", current, supported)
+	} else if current < supported {
+		logrus.Warnf("[graphstore] database schema version %d is older than the supported version %d", current, supported)
+	}
+
+	return nil
+}
+
+// Migrate applies each migration the database has not seen yet in order,
+// recording the schema version as each one completes. It fails when the
+// database uses a newer schema than the statements understand.
+func Migrate(db *sqlx.DB, statements *Statements) error {
+	if !statements.versioned() {
+		_, err := db.Exec(statements.CreateGraphDataTable)
+		return err
+	}
+
+	current, err := CurrentSchemaVersion(db, statements)
+	if err != nil {
+		return err
+	}
+
+	supported := statements.SchemaVersion()
+	if current > supported {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", current, supported)
+	}
+
+	for version := current + 1; version <= supported; version++ {
+		logrus.Infof("[graphstore] migrating database schema to version %d", version)
+
+		claimed, err := migrate(db, statements, version)
+		if err == nil {
+			continue
+		}
+
+		if !claimed {
+			// another replica that started at the same time may have claimed the
+			// version first, in which case it has already been applied
+			if applied, checkErr := selectSchemaVersion(db, statements); checkErr == nil && applied >= version {
+				logrus.Infof("[graphstore] database schema version %d was applied concurrently", version)
+				continue
+			}
+		} else {
+			forgetSchemaVersion(db, statements, version)
+		}
+
+		return fmt.Errorf("failed to migrate to schema version %d: %v", version, err)
+	}
+
+	return nil
+}
+
+// migrate applies a single migration, reporting whether the version was claimed
+// before it failed. The version is recorded before the migration statements run
+// so that its primary key serializes replicas migrating at the same time: the
+// first one to record the version blocks the others until it commits, after
+// which their inserts are rejected. MySQL commits schema changes implicitly,
+// which releases the claim early but still keeps replicas from applying a
+// migration twice.
+func migrate(db *sqlx.DB, statements *Statements, version int) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExec(statements.InsertSchemaVersion, map[string]interface{}{
+		"version": version,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, statement := range statements.Migrations[version-1] {
+		if _, err := tx.Exec(statement); err != nil {
+			return true, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// forgetSchemaVersion removes the version claimed by a failed migration. Rolling
+// back the migration removes it as well, unless the database committed it along
+// with a schema change.
+func forgetSchemaVersion(db *sqlx.DB, statements *Statements, version int) {
+	if len(statements.DeleteSchemaVersion) == 0 {
+		return
+	}
+
+	_, err := db.NamedExec(statements.DeleteSchemaVersion, map[string]interface{}{
+		"version": version,
+	})
+	if err != nil {
+		logrus.Errorf("[graphstore] failed to remove schema version %d after a failed migration: %v", version, err)
+	}
+}
@@ -0,0 +1,247 @@
+package graphstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"github.com/jmoiron/sqlx"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultScanCount is the number of items returned when no count is provided
+	defaultScanCount = 10
+	// maxScanCount is the largest number of items returned by a single scan
+	maxScanCount = 100
+	// maxScanFilters is the number of filters the scan statements accept
+	maxScanFilters = 4
+)
+
+// likeEscaper escapes the LIKE wildcards using the ESCAPE character used by
+// the scan statements.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// ScanFilter restricts a scan to items whose JSON encoded data contains a
+// string Field equal to Value, or starting with Value when Prefix is set.
+// Matching is performed against the encoded data, so it follows the collation
+// of the database.
+type ScanFilter struct {
+	Field  string
+	Value  string
+	Prefix bool
+}
+
+// fragment returns the text the encoded data of a matching item contains.
+func (f *ScanFilter) fragment() string {
+	field, _ := json.Marshal(f.Field)
+	value, _ := json.Marshal(f.Value)
+	if f.Prefix {
+		value = value[:len(value)-1]
+	}
+	return string(field) + ":" + string(value)
+}
+
+// matchesScanFilters reports whether the item matches every filter.
+func matchesScanFilters(item *store.GraphItem, filters []*ScanFilter) bool {
+	for _, filter := range filters {
+		if !strings.Contains(string(item.GetGraphItemData()), filter.fragment()) {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanRequest lists the live items of a type ordered by their keys. Unlike
+// store.ListRequest, pages are identified by a continuation token so that
+// items are neither skipped nor repeated as the graph changes while paging.
+type ScanRequest struct {
+	Type    string
+	Count   int32
+	Filters []*ScanFilter
+	// Token continues the scan after the last item of a previous response.
+	// It is empty when requesting the first page.
+	Token string
+}
+
+// ScanResponse contains a page of items.
+type ScanResponse struct {
+	Items []*store.GraphItem
+	// Count is the page size that was used after applying defaults and limits
+	Count int32
+	// NextToken continues the scan, or is empty once the last page was returned
+	NextToken string
+	// Total is the number of items matching the request across every page, or
+	// -1 when the graph store cannot count them
+	Total int64
+}
+
+// Scanner is implemented by graph stores that can page through items using
+// continuation tokens. Tokens are opaque and only valid for the store that
+// issued them.
+type Scanner interface {
+	Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error)
+}
+
+// ScanCount returns the page size used for the requested count. List uses the
+// same page size so that pages located by number line up with scanned pages.
+func ScanCount(count int32) int32 {
+	if count <= 0 {
+		return defaultScanCount
+	}
+	return min(count, maxScanCount)
+}
+
+// scanToken identifies the last item returned by a scan.
+type scanToken struct {
+	Type string `json:"t"`
+	K1   []byte `json:"k1"`
+	K2   []byte `json:"k2"`
+}
+
+func encodeScanToken(item *store.GraphItem) string {
+	data, _ := json.Marshal(&scanToken{
+		Type: item.GetGraphItemType(),
+		K1:   item.GetK1(),
+		K2:   item.GetK2(),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// validateScanFilters ensures the filters fit into the scan statements.
+func validateScanFilters(filters []*ScanFilter) error {
+	if len(filters) > maxScanFilters {
+		return status.Errorf(codes.InvalidArgument, "at most %d filters are supported", maxScanFilters)
+	}
+	return nil
+}
+
+// decodeScanToken reads the continuation token of the request. The first page
+// is represented by a token with empty keys.
+func decodeScanToken(req *ScanRequest) (*scanToken, error) {
+	token := &scanToken{Type: req.Type, K1: []byte{}, K2: []byte{}}
+	if len(req.Token) == 0 {
+		return token, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(req.Token)
+	if err == nil {
+		err = json.Unmarshal(data, token)
+	}
+
+	if err != nil || token.Type != req.Type {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid continuation token: %s", req.Token)
+	}
+
+	return token, nil
+}
+
+// newScanResponse trims the extra item fetched to detect whether another page
+// follows and issues the token for it.
+func newScanResponse(items []*store.GraphItem, count int32, total int64) *ScanResponse {
+	resp := &ScanResponse{Items: items, Count: count, Total: total}
+
+	if int32(len(items)) > count {
+		resp.Items = items[:count]
+		resp.NextToken = encodeScanToken(resp.Items[count-1])
+	}
+
+	return resp
+}
+
+var _ Scanner = &graphStore{}
+
+func (gs *graphStore) Scan(ctx context.Context, req *ScanRequest) (*ScanResponse, error) {
+	if len(gs.statements.ScanGraphData) == 0 {
+		return nil, api.ErrUnimplemented
+	}
+
+	if err := validateScanFilters(req.Filters); err != nil {
+		return nil, err
+	}
+
+	token, err := decodeScanToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	count := ScanCount(req.Count)
+
+	args := map[string]interface{}{
+		"graph_item_type": req.Type,
+		"k1":              Base64encode(token.K1),
+		"k2":              Base64encode(token.K2),
+		"limit":           count + 1,
+	}
+
+	// unused filters match everything
+	for i := 0; i < maxScanFilters; i++ {
+		pattern := "%"
+		if i < len(req.Filters) {
+			pattern = "%" + likeEscaper.Replace(req.Filters[i].fragment()) + "%"
+		}
+		args[fmt.Sprintf("filter_%d", i)] = pattern
+	}
+
+	statement, err := pointInTime(ctx, gs.statements.ScanGraphData, gs.statements.ScanGraphDataAsOf, args)
+	if err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	rows, err := gs.rodb.NamedQueryContext(queryCtx, statement, args)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
+	items, err := readGraphItems(rows)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
+	total, err := gs.count(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return newScanResponse(items, count, total), nil
+}
+
+// count returns the number of items matching the scan, or -1 when the
+// statements cannot count them.
+func (gs *graphStore) count(ctx context.Context, args map[string]interface{}) (int64, error) {
+	if len(gs.statements.CountGraphData) == 0 {
+		return -1, nil
+	}
+
+	statement, err := pointInTime(ctx, gs.statements.CountGraphData, gs.statements.CountGraphDataAsOf, args)
+	if err == api.ErrUnimplemented {
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	query, params, err := sqlx.Named(statement, args)
+	if err != nil {
+		return 0, err
+	}
+
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	var total int64
+	if err := gs.rodb.GetContext(queryCtx, &total, gs.rodb.Rebind(query), params...); err != nil {
+		return 0, queryError(queryCtx, err)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,442 @@
+package graphstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"github.com/jmoiron/sqlx"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxSearchWordLength limits the number of runes of each word that are indexed
+	maxSearchWordLength = 64
+	// searchCandidates is the number of items sharing the most trigrams with the
+	// query that are scored and ranked by the SQL graph store
+	searchCandidates = 1000
+	// fuzzyThreshold is the trigram similarity a word must have with a query
+	// word to be considered a typo of it
+	fuzzyThreshold = 0.3
+)
+
+// SearchRequest looks up nodes whose text matches the Query. The text of a node
+// consists of the top level string fields of its JSON encoded data. Each word
+// of the query must match a word of the text exactly, as a prefix, as a
+// substring, or as a likely typo.
+type SearchRequest struct {
+	Query string
+	// Types restricts the search to nodes of the provided types
+	Types []string
+	// DependentTypes are the types of edges counted as dependents of a node
+	DependentTypes []string
+	Count          int32
+}
+
+// SearchResult is a node matching the query.
+type SearchResult struct {
+	Item *store.GraphItem
+	// Dependents is the number of live edges of the DependentTypes that point
+	// to the node
+	Dependents int64
+	// Score measures how closely the node matches the query, between 0 and 1
+	Score float64
+}
+
+// SearchResponse contains the matching nodes with the most dependents first.
+// Nodes with the same number of dependents are ordered by their score.
+type SearchResponse struct {
+	Results []*SearchResult
+}
+
+// Searcher is implemented by graph stores that can search the text of nodes.
+type Searcher interface {
+	Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error)
+}
+
+// Indexer is implemented by graph stores that maintain a search index, which
+// can be rebuilt from the nodes they store.
+type Indexer interface {
+	// Reindex rebuilds the search index of the nodes of the provided types,
+	// returning the number of nodes that were indexed.
+	Reindex(ctx context.Context, types []string) (int64, error)
+}
+
+// searchWords splits text into lower case words of letters and digits.
+func searchWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		if runes := []rune(word); len(runes) > maxSearchWordLength {
+			words[i] = string(runes[:maxSearchWordLength])
+		}
+	}
+
+	return words
+}
+
+// trigrams returns the distinct trigrams of the word, padded so that the
+// leading and trailing characters of the word form trigrams of their own.
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + word + " ")
+	results := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		results[string(runes[i:i+3])] = true
+	}
+	return results
+}
+
+// similarity is the share of trigrams that the words have in common.
+func similarity(a, b map[string]bool) float64 {
+	shared := 0
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// searchText returns the words of the top level string fields of the item.
+func searchText(item *store.GraphItem) []string {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(item.GetGraphItemData(), &fields); err != nil {
+		return nil
+	}
+
+	words := make([]string, 0)
+	for _, value := range fields {
+		if text, ok := value.(string); ok {
+			words = append(words, searchWords(text)...)
+		}
+	}
+	return words
+}
+
+// searchTrigrams returns the trigrams indexed for the item. Only nodes are
+// searchable.
+func searchTrigrams(item *store.GraphItem) []string {
+	if string(item.GetK1()) != string(item.GetK2()) {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, word := range searchText(item) {
+		for trigram := range trigrams(word) {
+			set[trigram] = true
+		}
+	}
+
+	results := make([]string, 0, len(set))
+	for trigram := range set {
+		results = append(results, trigram)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// searchQuery scores items against the words of a query.
+type searchQuery struct {
+	words    []string
+	trigrams []map[string]bool
+	types    map[string]bool
+}
+
+func newSearchQuery(req *SearchRequest) (*searchQuery, error) {
+	words := searchWords(req.Query)
+	if len(words) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %q", req.Query)
+	} else if len(req.Types) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "at least one type must be searched")
+	}
+
+	q := &searchQuery{
+		words:    words,
+		trigrams: make([]map[string]bool, len(words)),
+		types:    make(map[string]bool, len(req.Types)),
+	}
+
+	for i, word := range words {
+		q.trigrams[i] = trigrams(word)
+	}
+
+	for _, t := range req.Types {
+		q.types[t] = true
+	}
+
+	return q, nil
+}
+
+// allTrigrams returns the trigrams of every word in the query.
+func (q *searchQuery) allTrigrams() []string {
+	set := make(map[string]bool)
+	for _, words := range q.trigrams {
+		for trigram := range words {
+			set[trigram] = true
+		}
+	}
+
+	results := make([]string, 0, len(set))
+	for trigram := range set {
+		results = append(results, trigram)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// score returns how closely the item matches the query. Exact matches score
+// higher than prefixes, which score higher than substrings and typos. Items
+// missing a word of the query do not match.
+func (q *searchQuery) score(item *store.GraphItem) (float64, bool) {
+	if !q.types[item.GetGraphItemType()] {
+		return 0, false
+	}
+
+	words := searchText(item)
+	total := 0.0
+
+	for i, query := range q.words {
+		best := 0.0
+		for _, word := range words {
+			var score float64
+			switch {
+			case word == query:
+				score = 1
+			case strings.HasPrefix(word, query):
+				score = 0.9
+			case strings.Contains(word, query):
+				score = 0.7
+			default:
+				if s := similarity(q.trigrams[i], trigrams(word)); s >= fuzzyThreshold {
+					score = 0.6 * s
+				}
+			}
+
+			if score > best {
+				best = score
+			}
+		}
+
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+
+	return total / float64(len(q.words)), true
+}
+
+// rankSearchResults orders the results by their dependents and score, keeping
+// at most count of them.
+func rankSearchResults(results []*SearchResult, count int32) *SearchResponse {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Dependents != b.Dependents {
+			return a.Dependents > b.Dependents
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return graphItemKey(a.Item) < graphItemKey(b.Item)
+	})
+
+	if int32(len(results)) > count {
+		results = results[:count]
+	}
+
+	return &SearchResponse{Results: results}
+}
+
+// indexed reports whether the item belongs in the search index.
+func (gs *graphStore) indexed(item *store.GraphItem) bool {
+	if string(item.GetK1()) != string(item.GetK2()) {
+		return false
+	}
+	return len(gs.searchTypes) == 0 || gs.searchTypes[item.GetGraphItemType()]
+}
+
+// searchSteps replace the indexed trigrams of the provided items. Deleted items
+// only have their trigrams removed.
+func (gs *graphStore) searchSteps(field string, items []*store.GraphItem, deleted bool) []*writeStep {
+	if gs.deleteSearchBatch == nil || gs.insertSearchBatch == nil {
+		return nil
+	}
+
+	remove := &writeStep{field: field, batch: gs.deleteSearchBatch, items: items}
+	insert := &writeStep{field: field, batch: gs.insertSearchBatch, items: items}
+
+	// the last occurrence of an item is the one that is written
+	last := make(map[string]int, len(items))
+	for i, item := range items {
+		if gs.indexed(item) {
+			last[graphItemKey(item)] = i
+		}
+	}
+
+	for i, item := range items {
+		if index, ok := last[graphItemKey(item)]; !ok || index != i {
+			continue
+		}
+
+		graphItemType := item.GetGraphItemType()
+		k1 := Base64encode(item.GetK1())
+
+		remove.rows = append(remove.rows, map[string]interface{}{
+			"graph_item_type": graphItemType,
+			"k1":              k1,
+		})
+		remove.indexes = append(remove.indexes, i)
+
+		if deleted {
+			continue
+		}
+
+		for _, trigram := range searchTrigrams(item) {
+			insert.rows = append(insert.rows, map[string]interface{}{
+				"graph_item_type": graphItemType,
+				"k1":              k1,
+				"trigram":         trigram,
+			})
+			insert.indexes = append(insert.indexes, i)
+		}
+	}
+
+	return []*writeStep{remove, insert}
+}
+
+var _ Searcher = &graphStore{}
+
+// Search ranks the searchCandidates nodes that share the most trigrams with the
+// query. Candidates are chosen before their dependents are counted, so a node
+// with many dependents is missing from the results when more than
+// searchCandidates nodes share more trigrams with the query than it does.
+func (gs *graphStore) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	if len(gs.statements.SearchGraphData) == 0 {
+		return nil, api.ErrUnimplemented
+	}
+
+	// the index only reflects the current graph
+	if AsOf(ctx) != nil {
+		return nil, api.ErrUnimplemented
+	}
+
+	q, err := newSearchQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// IN clauses may not be empty
+	dependentTypes := req.DependentTypes
+	if len(dependentTypes) == 0 {
+		dependentTypes = []string{""}
+	}
+
+	query, args, err := sqlx.Named(gs.statements.SearchGraphData, map[string]interface{}{
+		"trigrams":         q.allTrigrams(),
+		"graph_item_types": req.Types,
+		"dependent_types":  dependentTypes,
+		"candidates":       searchCandidates,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	rows, err := gs.rodb.QueryxContext(queryCtx, gs.rodb.Rebind(query), args...)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0)
+	for rows.Next() {
+		var (
+			t          string
+			k1         string
+			k2         string
+			enc        store.GraphItemEncoding
+			data       string
+			dependents int64
+		)
+
+		if err := rows.Scan(&t, &k1, &k2, &enc, &data, &dependents); err != nil {
+			return nil, queryError(queryCtx, err)
+		}
+
+		k1Bytes, _ := Base64decode(k1)
+		k2Bytes, _ := Base64decode(k2)
+
+		item := &store.GraphItem{
+			GraphItemType: t,
+			K1:            k1Bytes,
+			K2:            k2Bytes,
+			Encoding:      enc,
+			GraphItemData: []byte(data),
+		}
+
+		if score, ok := q.score(item); ok {
+			results = append(results, &SearchResult{Item: item, Dependents: dependents, Score: score})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
+	return rankSearchResults(results, ScanCount(req.Count)), nil
+}
+
+var _ Indexer = &graphStore{}
+
+func (gs *graphStore) Reindex(ctx context.Context, types []string) (int64, error) {
+	if gs.rwdb == nil {
+		return 0, api.ErrUnsupported
+	}
+
+	if gs.insertSearchBatch == nil || gs.deleteSearchBatch == nil || len(gs.statements.ScanGraphData) == 0 {
+		return 0, api.ErrUnimplemented
+	}
+
+	indexed := int64(0)
+	for _, t := range types {
+		for token := ""; ; {
+			resp, err := gs.Scan(ctx, &ScanRequest{Type: t, Count: maxScanCount, Token: token})
+			if err != nil {
+				return indexed, err
+			}
+
+			// each page is indexed in its own transaction
+			if err := gs.write(ctx, "reindex", gs.searchSteps("items", resp.Items, false)...); err != nil {
+				return indexed, err
+			}
+
+			for _, item := range resp.Items {
+				if gs.indexed(item) {
+					indexed++
+				}
+			}
+
+			if token = resp.NextToken; token == "" {
+				break
+			}
+		}
+	}
+
+	return indexed, nil
+}
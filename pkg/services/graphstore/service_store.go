@@ -2,6 +2,7 @@ package graphstore
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/deps-cloud/api"
@@ -10,28 +11,124 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// NewSQLGraphStore constructs a new GraphStore with a sql driven backend. Current
-// queries support sqlite3 but should be able to work on mysql as well.
-func NewSQLGraphStore(rwdb, rodb *sqlx.DB, statements *Statements) (store.GraphStoreServer, error) {
+// NewSQLGraphStore constructs a new GraphStore with a sql driven backend. When
+// statements are nil, the built in statements for the database driver are used.
+// Built in statements exist for sqlite3, mysql, and postgres. Pending migrations
+// are applied using the read-write database when one is provided.
+func NewSQLGraphStore(rwdb, rodb *sqlx.DB, statements *Statements, opts ...SQLGraphStoreOption) (store.GraphStoreServer, error) {
+	if statements == nil {
+		db := rwdb
+		if db == nil {
+			db = rodb
+		}
+
+		if db == nil {
+			return nil, fmt.Errorf("either a read-write or read-only database must be provided")
+		}
+
+		var err error
+		if statements, err = StatementsForDriver(db.DriverName()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := statements.Validate(); err != nil {
+		return nil, err
+	}
+
 	if rwdb != nil {
-		if _, err := rwdb.Exec(statements.CreateGraphDataTable); err != nil {
+		if err := Migrate(rwdb, statements); err != nil {
 			return nil, err
 		}
+	} else if err := CheckSchemaVersion(rodb, statements); err != nil {
+		return nil, err
 	}
 
-	return &graphStore{
-		rwdb:       rwdb,
-		rodb:       rodb,
-		statements: statements,
-	}, nil
+	gs := &graphStore{
+		rwdb:        rwdb,
+		rodb:        rodb,
+		statements:  statements,
+		insertBatch: newBatchStatement(statements.InsertGraphData, statements.MaxParameters),
+		deleteBatch: newBatchStatement(statements.DeleteGraphData, statements.MaxParameters),
+	}
+
+	for _, opt := range opts {
+		opt(gs)
+	}
+
+	// the search index is optional
+	if len(statements.InsertGraphSearch) > 0 && len(statements.DeleteGraphSearch) > 0 {
+		gs.insertSearchBatch = newBatchStatement(statements.InsertGraphSearch, statements.MaxParameters)
+		gs.deleteSearchBatch = newBatchStatement(statements.DeleteGraphSearch, statements.MaxParameters)
+	}
+
+	return gs, nil
 }
 
 type graphStore struct {
-	rwdb       *sqlx.DB
-	rodb       *sqlx.DB
-	statements *Statements
+	rwdb              *sqlx.DB
+	rodb              *sqlx.DB
+	statements        *Statements
+	insertBatch       *batchStatement
+	deleteBatch       *batchStatement
+	insertSearchBatch *batchStatement
+	deleteSearchBatch *batchStatement
+	searchTypes       map[string]bool
+	queryTimeout      time.Duration
+}
+
+// SQLGraphStoreOption configures the graph store constructed by NewSQLGraphStore.
+type SQLGraphStoreOption func(gs *graphStore)
+
+// WithQueryTimeout bounds how long each query may run, in addition to any
+// deadline of the request. Writes are bounded per statement batch rather than
+// per transaction. A timeout of 0 leaves queries unbounded.
+func WithQueryTimeout(timeout time.Duration) SQLGraphStoreOption {
+	return func(gs *graphStore) {
+		gs.queryTimeout = timeout
+	}
+}
+
+// WithSearchTypes restricts the search index to nodes of the provided types.
+// Nodes of other types cannot be found using Search. Nodes of every type are
+// indexed when no types are provided.
+func WithSearchTypes(types ...string) SQLGraphStoreOption {
+	return func(gs *graphStore) {
+		gs.searchTypes = make(map[string]bool, len(types))
+		for _, t := range types {
+			gs.searchTypes[t] = true
+		}
+	}
+}
+
+// queryContext derives the context a single query runs with. Queries are
+// interrupted once the request is cancelled or the query timeout elapses.
+func (gs *graphStore) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if gs.queryTimeout > 0 {
+		return context.WithTimeout(ctx, gs.queryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// queryError reports queries interrupted by their context using the matching
+// status code, so that callers can tell them apart from database failures.
+func queryError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return status.Errorf(codes.Canceled, "query cancelled: %v", err)
+	case context.DeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, "query timed out: %v", err)
+	}
+	return err
 }
 
 var _ store.GraphStoreServer = &graphStore{}
@@ -41,90 +138,211 @@ func (gs *graphStore) Put(ctx context.Context, req *store.PutRequest) (*store.Pu
 		return nil, api.ErrUnsupported
 	}
 
-	if len(req.GetItems()) == 0 {
-		return &store.PutResponse{}, nil
+	steps := append([]*writeStep{gs.putStep("items", req.GetItems(), time.Now())},
+		gs.searchSteps("items", req.GetItems(), false)...)
+
+	if err := gs.write(ctx, "put", steps...); err != nil {
+		logrus.Errorf("[graphstore] %s", err.Error())
+		return nil, err
 	}
 
-	timestamp := time.Now()
-	errors := make([]error, 0)
+	return &store.PutResponse{}, nil
+}
 
-	tx, err := gs.rwdb.Beginx()
-	if err != nil {
+func (gs *graphStore) Delete(ctx context.Context, req *store.DeleteRequest) (*store.DeleteResponse, error) {
+	if gs.rwdb == nil {
+		return nil, api.ErrUnsupported
+	}
+
+	steps := append([]*writeStep{gs.deleteStep("items", req.GetItems(), time.Now())},
+		gs.searchSteps("items", req.GetItems(), true)...)
+
+	if err := gs.write(ctx, "delete", steps...); err != nil {
+		logrus.Errorf("[graphstore] %s", err.Error())
 		return nil, err
 	}
-	defer tx.Rollback()
 
-	for _, item := range req.GetItems() {
-		_, err := tx.NamedExec(gs.statements.InsertGraphData, map[string]interface{}{
+	return &store.DeleteResponse{}, nil
+}
+
+// writeStep executes a batch for a list of requested items.
+type writeStep struct {
+	// field names the list of items within the request
+	field  string
+	batch  *batchStatement
+	shared map[string]interface{}
+	rows   []map[string]interface{}
+	items  []*store.GraphItem
+	// indexes maps each row to the position of its item within items
+	indexes []int
+}
+
+func (gs *graphStore) putStep(field string, items []*store.GraphItem, timestamp time.Time) *writeStep {
+	step := &writeStep{
+		field:   field,
+		batch:   gs.insertBatch,
+		rows:    make([]map[string]interface{}, 0, len(items)),
+		items:   items,
+		indexes: make([]int, 0, len(items)),
+	}
+
+	// multi-row statements may not affect the same row twice
+	positions := make(map[string]int, len(items))
+
+	for i, item := range items {
+		row := map[string]interface{}{
 			"graph_item_type": item.GetGraphItemType(),
 			"k1":              Base64encode(item.GetK1()),
 			"k2":              Base64encode(item.GetK2()),
 			"encoding":        item.GetEncoding(),
 			"graph_item_data": string(item.GetGraphItemData()),
 			"last_modified":   timestamp,
-		})
+		}
 
-		if err != nil {
-			errors = append(errors, err)
+		key := graphItemKey(item)
+		if position, ok := positions[key]; ok {
+			step.rows[position] = row
+			step.indexes[position] = i
+		} else {
+			positions[key] = len(step.rows)
+			step.rows = append(step.rows, row)
+			step.indexes = append(step.indexes, i)
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	return step
+}
+
+func (gs *graphStore) deleteStep(field string, items []*store.GraphItem, timestamp time.Time) *writeStep {
+	step := &writeStep{
+		field: field,
+		batch: gs.deleteBatch,
+		shared: map[string]interface{}{
+			"date_deleted": timestamp,
+		},
+		rows:    make([]map[string]interface{}, 0, len(items)),
+		items:   items,
+		indexes: make([]int, 0, len(items)),
 	}
 
-	if len(errors) > 0 {
-		for _, err := range errors {
-			logrus.Errorf(err.Error())
+	seen := make(map[string]bool, len(items))
+
+	for i, item := range items {
+		key := graphItemKey(item)
+		if seen[key] {
+			continue
 		}
-		return nil, api.ErrPartialInsertion
+		seen[key] = true
+
+		step.rows = append(step.rows, map[string]interface{}{
+			"graph_item_type": item.GetGraphItemType(),
+			"k1":              Base64encode(item.GetK1()),
+			"k2":              Base64encode(item.GetK2()),
+		})
+		step.indexes = append(step.indexes, i)
 	}
 
-	return &store.PutResponse{}, nil
+	return step
 }
 
-func (gs *graphStore) Delete(ctx context.Context, req *store.DeleteRequest) (*store.DeleteResponse, error) {
-	if gs.rwdb == nil {
-		return nil, api.ErrUnsupported
+// write executes each step in order within a single transaction. Either every
+// row is written or none of them are. When a chunk of rows fails, each row in
+// the chunk is retried on its own to find the items responsible.
+func (gs *graphStore) write(ctx context.Context, action string, steps ...*writeStep) error {
+	empty := true
+	for _, step := range steps {
+		empty = empty && len(step.rows) == 0
+	}
+
+	if empty {
+		return nil
 	}
 
-	if len(req.GetItems()) == 0 {
-		return &store.DeleteResponse{}, nil
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	timestamp := time.Now()
-	errors := make([]error, 0)
+	aborted := func(ctx context.Context, err error) error {
+		if ctx.Err() != nil {
+			return queryError(ctx, err)
+		}
+		return status.Errorf(codes.Aborted, "failed to %s items, no changes were made: %v", action, err)
+	}
 
-	tx, err := gs.rwdb.Beginx()
+	tx, err := gs.rwdb.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return aborted(ctx, err)
 	}
 	defer tx.Rollback()
 
-	for _, key := range req.GetItems() {
-		_, err := tx.NamedExec(gs.statements.DeleteGraphData, map[string]interface{}{
-			"date_deleted":    timestamp,
-			"graph_item_type": key.GetGraphItemType(),
-			"k1":              Base64encode(key.GetK1()),
-			"k2":              Base64encode(key.GetK2()),
-		})
-		if err != nil {
-			errors = append(errors, err)
+	for _, step := range steps {
+		queryCtx, cancel := gs.queryContext(ctx)
+		err := step.batch.exec(queryCtx, tx, step.shared, step.rows)
+		interrupted := queryCtx.Err() != nil
+		cancel()
+
+		if err == nil {
+			continue
 		}
+
+		// interrupted statements say nothing about the items, and neither do
+		// failures outside of a chunk of rows
+		chunk, ok := err.(*batchError)
+		if interrupted || !ok {
+			return aborted(queryCtx, err)
+		}
+
+		// release the connection before probing the rows of the chunk
+		_ = tx.Rollback()
+
+		return newWriteError(action, gs.probe(ctx, step, chunk))
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return aborted(ctx, err)
+	}
+
+	return nil
+}
+
+// probe executes each row of the failed chunk in a transaction that is always
+// rolled back. When no row fails on its own, the chunk is blamed as a whole.
+func (gs *graphStore) probe(ctx context.Context, step *writeStep, chunk *batchError) []*ItemError {
+	failures := make([]*ItemError, 0)
+
+	failed := func(row int, err error) {
+		index := step.indexes[row]
+		failures = append(failures, &ItemError{step.field, index, step.items[index], err})
 	}
 
-	if len(errors) > 0 {
-		for _, err := range errors {
-			logrus.Errorf(err.Error())
+	for row := chunk.start; row < chunk.end; row++ {
+		tx, err := gs.rwdb.BeginTxx(ctx, nil)
+		if err != nil {
+			break
 		}
-		return nil, api.ErrPartialDeletion
+
+		queryCtx, cancel := gs.queryContext(ctx)
+		err = step.batch.exec(queryCtx, tx, step.shared, step.rows[row:row+1])
+		if rowErr, ok := err.(*batchError); ok && queryCtx.Err() == nil {
+			failed(row, rowErr.err)
+		}
+		cancel()
+
+		_ = tx.Rollback()
 	}
 
-	return &store.DeleteResponse{}, nil
+	if len(failures) == 0 {
+		for row := chunk.start; row < chunk.end; row++ {
+			failed(row, chunk.err)
+		}
+	}
+
+	return failures
+}
+
+// graphItemKey identifies the row a graph item is stored in
+func graphItemKey(item *store.GraphItem) string {
+	return string(boltKey([]byte(item.GetGraphItemType()), item.GetK1(), item.GetK2()))
 }
 
 func max(a, b int32) int32 {
@@ -141,25 +359,50 @@ func min(a, b int32) int32 {
 	return b
 }
 
+// pointInTime returns the statement to use for the point in time requested by
+// the context. Statements for historical queries are optional, so asking for a
+// point in time without one fails with api.ErrUnimplemented.
+func pointInTime(ctx context.Context, statement, asOfStatement string, args map[string]interface{}) (string, error) {
+	asOf := AsOf(ctx)
+	if asOf == nil {
+		return statement, nil
+	} else if len(asOfStatement) == 0 {
+		return "", api.ErrUnimplemented
+	}
+
+	args["as_of"] = *asOf
+	return asOfStatement, nil
+}
+
 func (gs *graphStore) List(ctx context.Context, req *store.ListRequest) (*store.ListResponse, error) {
 	graphItemType := req.GetType()
 	page := max(req.GetPage(), 1)
 
-	limit := max(min(req.GetCount(), 100), 10)
+	limit := ScanCount(req.GetCount())
 	offset := (page - 1) * limit
 
-	rows, err := gs.rodb.NamedQuery(gs.statements.ListGraphData, map[string]interface{}{
+	args := map[string]interface{}{
 		"graph_item_type": graphItemType,
 		"limit":           limit,
 		"offset":          offset,
-	})
+	}
+
+	statement, err := pointInTime(ctx, gs.statements.ListGraphData, gs.statements.ListGraphDataAsOf, args)
 	if err != nil {
 		return nil, err
 	}
 
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	rows, err := gs.rodb.NamedQueryContext(queryCtx, statement, args)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
 	items, err := readGraphItems(rows)
 	if err != nil {
-		return nil, err
+		return nil, queryError(queryCtx, err)
 	}
 
 	return &store.ListResponse{
@@ -168,56 +411,45 @@ func (gs *graphStore) List(ctx context.Context, req *store.ListRequest) (*store.
 }
 
 func (gs *graphStore) FindUpstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
-	query, args, err := sqlx.Named(gs.statements.SelectGraphDataUpstreamDependencies, map[string]interface{}{
+	return gs.find(ctx, gs.statements.SelectGraphDataUpstreamDependencies, gs.statements.SelectGraphDataUpstreamDependenciesAsOf, req)
+}
+
+func (gs *graphStore) FindDownstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
+	return gs.find(ctx, gs.statements.SelectGraphDataDownstreamDependencies, gs.statements.SelectGraphDataDownstreamDependenciesAsOf, req)
+}
+
+func (gs *graphStore) find(ctx context.Context, statement, asOfStatement string, req *store.FindRequest) (*store.FindResponse, error) {
+	args := map[string]interface{}{
 		"key":        Base64encode(req.GetKey()),
 		"edge_types": req.GetEdgeTypes(),
-	})
-	if err != nil {
-		return nil, err
 	}
 
-	query, args, err = sqlx.In(query, args...)
+	statement, err := pointInTime(ctx, statement, asOfStatement, args)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := gs.rodb.Queryx(query, args...)
+	query, params, err := sqlx.Named(statement, args)
 	if err != nil {
 		return nil, err
 	}
 
-	pairs, err := readGraphItemPairs(rows)
+	query, params, err = sqlx.In(query, params...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &store.FindResponse{
-		Pairs: pairs,
-	}, nil
-}
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
 
-func (gs *graphStore) FindDownstream(ctx context.Context, req *store.FindRequest) (*store.FindResponse, error) {
-	query, args, err := sqlx.Named(gs.statements.SelectGraphDataDownstreamDependencies, map[string]interface{}{
-		"key":        Base64encode(req.GetKey()),
-		"edge_types": req.GetEdgeTypes(),
-	})
+	rows, err := gs.rodb.QueryxContext(queryCtx, gs.rodb.Rebind(query), params...)
 	if err != nil {
-		return nil, err
-	}
-
-	query, args, err = sqlx.In(query, args...)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := gs.rodb.Queryx(query, args...)
-	if err != nil {
-		return nil, err
+		return nil, queryError(queryCtx, err)
 	}
 
 	pairs, err := readGraphItemPairs(rows)
 	if err != nil {
-		return nil, err
+		return nil, queryError(queryCtx, err)
 	}
 
 	return &store.FindResponse{
@@ -257,6 +489,10 @@ func readGraphItems(rows *sqlx.Rows) ([]*store.GraphItem, error) {
 		results = append(results, item)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return results, nil
 }
 
@@ -308,5 +544,9 @@ func readGraphItemPairs(rows *sqlx.Rows) ([]*store.GraphItemPair, error) {
 		results = append(results, pair)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return results, nil
 }
@@ -0,0 +1,209 @@
+package graphstore_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/stretchr/testify/require"
+)
+
+var benchmarkGraphSize = flag.Int("graph-size", 1000000, "the number of rows in the graph used by benchmarks")
+
+var benchmarkGraphStores = make(map[string]store.GraphStoreServer)
+
+func benchmarkKey(i int) []byte {
+	return []byte(fmt.Sprintf("%064x", i))
+}
+
+// newBenchmarkGraphStore returns a sqlite backed GraphStore holding a graph of
+// benchmarkGraphSize rows where half of the rows are nodes and the other half
+// are edges. Each node depends on the node at half of its index, forming a
+// binary tree. When indexed is false, the migration adding the k1 and k2
+// indexes is skipped. Graphs are shared between benchmarks since they are
+// expensive to build.
+func newBenchmarkGraphStore(b *testing.B, indexed bool) store.GraphStoreServer {
+	name := fmt.Sprintf("Benchmark_%d_%t", *benchmarkGraphSize, indexed)
+	if graphStore, ok := benchmarkGraphStores[name]; ok {
+		return graphStore
+	}
+
+	statements := graphstore.DefaultStatements()
+	if !indexed {
+		// later migrations still apply, so the version numbers are kept
+		statements.Migrations[1] = nil
+	}
+
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	require.Nil(b, err)
+
+	graphStore, err := graphstore.NewSQLGraphStore(db, db, statements)
+	require.Nil(b, err)
+
+	tx, err := db.Beginx()
+	require.Nil(b, err)
+
+	stmt, err := tx.PrepareNamed(statements.InsertGraphData)
+	require.Nil(b, err)
+
+	timestamp := time.Now()
+	nodes := *benchmarkGraphSize / 2
+
+	for i := 0; i < nodes; i++ {
+		key := benchmarkKey(i)
+
+		_, err := stmt.Exec(map[string]interface{}{
+			"graph_item_type": "node",
+			"k1":              key,
+			"k2":              key,
+			"encoding":        0,
+			"graph_item_data": "{}",
+			"last_modified":   timestamp,
+		})
+		require.Nil(b, err)
+
+		_, err = stmt.Exec(map[string]interface{}{
+			"graph_item_type": "edge",
+			"k1":              key,
+			"k2":              benchmarkKey(i / 2),
+			"encoding":        0,
+			"graph_item_data": "{}",
+			"last_modified":   timestamp,
+		})
+		require.Nil(b, err)
+	}
+
+	require.Nil(b, tx.Commit())
+
+	benchmarkGraphStores[name] = graphStore
+	return graphStore
+}
+
+func benchmarkFind(b *testing.B, downstream bool) {
+	for _, indexed := range []bool{true, false} {
+		b.Run(fmt.Sprintf("indexed=%t", indexed), func(b *testing.B) {
+			graphStore := newBenchmarkGraphStore(b, indexed)
+			nodes := *benchmarkGraphSize / 2
+			random := rand.New(rand.NewSource(0))
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				req := &store.FindRequest{
+					Key:       benchmarkKey(random.Intn(nodes)),
+					EdgeTypes: []string{"edge"},
+				}
+
+				var err error
+				if downstream {
+					_, err = graphStore.FindDownstream(context.Background(), req)
+				} else {
+					_, err = graphStore.FindUpstream(context.Background(), req)
+				}
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindUpstream(b *testing.B) {
+	benchmarkFind(b, false)
+}
+
+func BenchmarkFindDownstream(b *testing.B) {
+	benchmarkFind(b, true)
+}
+
+// benchmarkWrite measures the time to put or delete a batch of items using
+// statements that bind at most maxParameters parameters. The search index is
+// left out, since writing its trigrams would dominate the measurements.
+func benchmarkWrite(b *testing.B, db *sqlx.DB, items int, maxParameters int, delete bool) {
+	statements, err := graphstore.StatementsForDriver(db.DriverName())
+	require.Nil(b, err)
+	statements.MaxParameters = maxParameters
+	statements.InsertGraphSearch = ""
+	statements.DeleteGraphSearch = ""
+
+	graphStore, err := graphstore.NewSQLGraphStore(db, db, statements)
+	require.Nil(b, err)
+
+	data := make([]*store.GraphItem, 0, items)
+	for i := 0; i < items; i++ {
+		key := benchmarkKey(i)
+		data = append(data, &store.GraphItem{GraphItemType: "bench", K1: key, K2: key, GraphItemData: []byte("{}")})
+	}
+
+	put := func() {
+		if _, err := graphStore.Put(context.Background(), &store.PutRequest{Items: data}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	remove := func() {
+		if _, err := graphStore.Delete(context.Background(), &store.DeleteRequest{Items: data}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// only the requested write is timed, the other one resets the items
+	measured, reset := put, remove
+	if delete {
+		measured, reset = remove, put
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		reset()
+		b.StartTimer()
+
+		measured()
+	}
+}
+
+// BenchmarkWrite compares writing one item per statement with writing many.
+// SQLite runs in process, so the difference is far larger against databases
+// reached over the network. Set POSTGRES_ADDRESS to include PostgreSQL.
+func BenchmarkWrite(b *testing.B) {
+	drivers := map[string]string{
+		"sqlite3": "file:BenchmarkWrite?mode=memory&cache=shared",
+	}
+
+	if address := os.Getenv("POSTGRES_ADDRESS"); len(address) > 0 {
+		drivers["postgres"] = address
+	}
+
+	for driver, address := range drivers {
+		db, err := sqlx.Open(driver, address)
+		require.Nil(b, err)
+		defer db.Close()
+
+		for _, items := range []int{1000, 10000, 100000} {
+			for _, write := range []string{"put", "delete"} {
+				delete := write == "delete"
+
+				// a single parameter forces one statement per item
+				b.Run(fmt.Sprintf("%s/%s/items=%d/unbatched", driver, write, items), func(b *testing.B) {
+					benchmarkWrite(b, db, items, 1, delete)
+				})
+
+				b.Run(fmt.Sprintf("%s/%s/items=%d/batched", driver, write, items), func(b *testing.B) {
+					benchmarkWrite(b, db, items, 0, delete)
+				})
+			}
+		}
+	}
+}
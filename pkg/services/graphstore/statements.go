@@ -1,25 +1,59 @@
 package graphstore
 
 import (
+	"fmt"
 	"io/ioutil"
 
 	"github.com/ghodss/yaml"
 )
 
 // Statements defines the SQL statements that are used by the GraphStore. Each
-// statement should use named parameters.
+// statement should use named parameters. The row following VALUES in
+// insertGraphData and the parenthesized condition following WHERE in
+// deleteGraphData are repeated to write many items with a single statement.
+// MaxParameters limits the number of parameters bound to each of those
+// statements.
 type Statements struct {
-	CreateGraphDataTable                  string `json:"createGraphDataTable"`
-	InsertGraphData                       string `json:"insertGraphData"`
-	DeleteGraphData                       string `json:"deleteGraphData"`
-	ListGraphData                         string `json:"listGraphData"`
-	SelectGraphDataUpstreamDependencies   string `json:"selectGraphDataUpstreamDependencies"`
-	SelectGraphDataDownstreamDependencies string `json:"selectGraphDataDownstreamDependencies"`
+	MaxParameters int `json:"maxParameters"`
+
+	CreateGraphDataTable                          string `json:"createGraphDataTable"`
+	InsertGraphData                               string `json:"insertGraphData"`
+	DeleteGraphData                               string `json:"deleteGraphData"`
+	ListGraphData                                 string `json:"listGraphData"`
+	ListGraphDataAsOf                             string `json:"listGraphDataAsOf"`
+	ScanGraphData                                 string `json:"scanGraphData"`
+	ScanGraphDataAsOf                             string `json:"scanGraphDataAsOf"`
+	CountGraphData                                string `json:"countGraphData"`
+	CountGraphDataAsOf                            string `json:"countGraphDataAsOf"`
+	SelectGraphDataUpstreamDependencies           string `json:"selectGraphDataUpstreamDependencies"`
+	SelectGraphDataDownstreamDependencies         string `json:"selectGraphDataDownstreamDependencies"`
+	SelectGraphDataUpstreamDependenciesAsOf       string `json:"selectGraphDataUpstreamDependenciesAsOf"`
+	SelectGraphDataDownstreamDependenciesAsOf     string `json:"selectGraphDataDownstreamDependenciesAsOf"`
+	SelectGraphDataUpstreamTraversal              string `json:"selectGraphDataUpstreamTraversal"`
+	SelectGraphDataDownstreamTraversal            string `json:"selectGraphDataDownstreamTraversal"`
+	SelectGraphDataUpstreamTraversalWithinDepth   string `json:"selectGraphDataUpstreamTraversalWithinDepth"`
+	SelectGraphDataDownstreamTraversalWithinDepth string `json:"selectGraphDataDownstreamTraversalWithinDepth"`
+
+	DeleteOrphanedGraphData string `json:"deleteOrphanedGraphData"`
+	PurgeGraphData          string `json:"purgeGraphData"`
+
+	InsertGraphSearch string `json:"insertGraphSearch"`
+	DeleteGraphSearch string `json:"deleteGraphSearch"`
+	SearchGraphData   string `json:"searchGraphData"`
+	PurgeGraphSearch  string `json:"purgeGraphSearch"`
+
+	CreateSchemaVersionTable string     `json:"createSchemaVersionTable"`
+	SelectSchemaVersion      string     `json:"selectSchemaVersion"`
+	InsertSchemaVersion      string     `json:"insertSchemaVersion"`
+	DeleteSchemaVersion      string     `json:"deleteSchemaVersion"`
+	Migrations               [][]string `json:"migrations"`
 }
 
 // sqlStatements
 const sqlStatements = `
-createGraphDataTable: |
+maxParameters: 999
+
+createGraphDataTable: &createGraphDataTable |
   CREATE TABLE IF NOT EXISTS dts_graphdata(
       graph_item_type VARCHAR(55),
       k1 CHAR(64),
@@ -31,10 +65,18 @@ createGraphDataTable: |
       PRIMARY KEY (graph_item_type, k1, k2)
   );
 
+# date_created is kept while the item remains live so that point in time
+# queries can tell how long the item has existed.
 insertGraphData: |
-  REPLACE INTO dts_graphdata 
-  (graph_item_type, k1, k2, encoding, graph_item_data, last_modified, date_deleted)
-  VALUES (:graph_item_type, :k1, :k2, :encoding, :graph_item_data, :last_modified, NULL);
+  INSERT INTO dts_graphdata
+  (graph_item_type, k1, k2, encoding, graph_item_data, last_modified, date_deleted, date_created)
+  VALUES (:graph_item_type, :k1, :k2, :encoding, :graph_item_data, :last_modified, NULL, :last_modified)
+  ON CONFLICT (graph_item_type, k1, k2) DO UPDATE SET
+      date_created = CASE WHEN dts_graphdata.date_deleted IS NULL THEN dts_graphdata.date_created ELSE excluded.date_created END,
+      encoding = excluded.encoding,
+      graph_item_data = excluded.graph_item_data,
+      last_modified = excluded.last_modified,
+      date_deleted = NULL;
 
 deleteGraphData: |
   UPDATE dts_graphdata
@@ -44,9 +86,34 @@ deleteGraphData: |
 listGraphData: |
   SELECT graph_item_type, k1, k2, encoding, graph_item_data
   FROM dts_graphdata
-  WHERE graph_item_type = :graph_item_type 
+  WHERE graph_item_type = :graph_item_type
+  AND date_deleted IS NULL
+  ORDER BY k1, k2
   LIMIT :limit OFFSET :offset;
 
+scanGraphData: |
+  SELECT graph_item_type, k1, k2, encoding, graph_item_data
+  FROM dts_graphdata
+  WHERE graph_item_type = :graph_item_type
+  AND (k1 > :k1 OR (k1 = :k1 AND k2 > :k2))
+  AND (:filter_0 = '%' OR graph_item_data LIKE :filter_0 ESCAPE '!')
+  AND (:filter_1 = '%' OR graph_item_data LIKE :filter_1 ESCAPE '!')
+  AND (:filter_2 = '%' OR graph_item_data LIKE :filter_2 ESCAPE '!')
+  AND (:filter_3 = '%' OR graph_item_data LIKE :filter_3 ESCAPE '!')
+  AND date_deleted IS NULL
+  ORDER BY k1, k2
+  LIMIT :limit;
+
+countGraphData: |
+  SELECT COUNT(*)
+  FROM dts_graphdata
+  WHERE graph_item_type = :graph_item_type
+  AND (:filter_0 = '%' OR graph_item_data LIKE :filter_0 ESCAPE '!')
+  AND (:filter_1 = '%' OR graph_item_data LIKE :filter_1 ESCAPE '!')
+  AND (:filter_2 = '%' OR graph_item_data LIKE :filter_2 ESCAPE '!')
+  AND (:filter_3 = '%' OR graph_item_data LIKE :filter_3 ESCAPE '!')
+  AND date_deleted IS NULL;
+
 selectGraphDataUpstreamDependencies: |
   SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
           g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
@@ -70,6 +137,258 @@ selectGraphDataDownstreamDependencies: |
   AND g2.date_deleted IS NULL
   AND g1.k1 = g1.k2 
   AND g1.date_deleted IS NULL;
+
+selectGraphDataUpstreamTraversal: |
+  WITH RECURSIVE traversal(k) AS (
+      SELECT CAST(:key AS CHAR(64))
+      UNION
+      SELECT g.k2
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k1 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM traversal AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k1 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k1 = g2.k2
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataDownstreamTraversal: |
+  WITH RECURSIVE traversal(k) AS (
+      SELECT CAST(:key AS CHAR(64))
+      UNION
+      SELECT g.k1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k2 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM traversal AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k2 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k2 = g2.k1
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataUpstreamTraversalWithinDepth: |
+  WITH RECURSIVE traversal(k, depth) AS (
+      SELECT CAST(:key AS CHAR(64)), 0
+      UNION
+      SELECT g.k2, t.depth + 1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k1 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+      AND t.depth + 1 < :max_depth
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM (SELECT DISTINCT k FROM traversal) AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k1 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k1 = g2.k2
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataDownstreamTraversalWithinDepth: |
+  WITH RECURSIVE traversal(k, depth) AS (
+      SELECT CAST(:key AS CHAR(64)), 0
+      UNION
+      SELECT g.k1, t.depth + 1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k2 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+      AND t.depth + 1 < :max_depth
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM (SELECT DISTINCT k FROM traversal) AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k2 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k2 = g2.k1
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+listGraphDataAsOf: |
+  SELECT graph_item_type, k1, k2, encoding, graph_item_data
+  FROM dts_graphdata
+  WHERE graph_item_type = :graph_item_type
+  AND date_created <= :as_of
+  AND (date_deleted IS NULL OR date_deleted > :as_of)
+  ORDER BY k1, k2
+  LIMIT :limit OFFSET :offset;
+
+scanGraphDataAsOf: |
+  SELECT graph_item_type, k1, k2, encoding, graph_item_data
+  FROM dts_graphdata
+  WHERE graph_item_type = :graph_item_type
+  AND (k1 > :k1 OR (k1 = :k1 AND k2 > :k2))
+  AND (:filter_0 = '%' OR graph_item_data LIKE :filter_0 ESCAPE '!')
+  AND (:filter_1 = '%' OR graph_item_data LIKE :filter_1 ESCAPE '!')
+  AND (:filter_2 = '%' OR graph_item_data LIKE :filter_2 ESCAPE '!')
+  AND (:filter_3 = '%' OR graph_item_data LIKE :filter_3 ESCAPE '!')
+  AND date_created <= :as_of
+  AND (date_deleted IS NULL OR date_deleted > :as_of)
+  ORDER BY k1, k2
+  LIMIT :limit;
+
+countGraphDataAsOf: |
+  SELECT COUNT(*)
+  FROM dts_graphdata
+  WHERE graph_item_type = :graph_item_type
+  AND (:filter_0 = '%' OR graph_item_data LIKE :filter_0 ESCAPE '!')
+  AND (:filter_1 = '%' OR graph_item_data LIKE :filter_1 ESCAPE '!')
+  AND (:filter_2 = '%' OR graph_item_data LIKE :filter_2 ESCAPE '!')
+  AND (:filter_3 = '%' OR graph_item_data LIKE :filter_3 ESCAPE '!')
+  AND date_created <= :as_of
+  AND (date_deleted IS NULL OR date_deleted > :as_of);
+
+selectGraphDataUpstreamDependenciesAsOf: |
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM dts_graphdata AS g1
+  INNER JOIN dts_graphdata AS g2 ON g1.k1 = g2.k2
+  WHERE g2.k1 = :key
+  AND g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_created <= :as_of
+  AND (g2.date_deleted IS NULL OR g2.date_deleted > :as_of)
+  AND g1.k1 = g1.k2
+  AND g1.date_created <= :as_of
+  AND (g1.date_deleted IS NULL OR g1.date_deleted > :as_of);
+
+selectGraphDataDownstreamDependenciesAsOf: |
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM dts_graphdata AS g1
+  INNER JOIN dts_graphdata AS g2 ON g1.k2 = g2.k1
+  WHERE g2.k2 = :key
+  AND g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_created <= :as_of
+  AND (g2.date_deleted IS NULL OR g2.date_deleted > :as_of)
+  AND g1.k1 = g1.k2
+  AND g1.date_created <= :as_of
+  AND (g1.date_deleted IS NULL OR g1.date_deleted > :as_of);
+
+# live edges are selected through a derived table since MySQL does not allow
+# selecting from the table being updated within a subquery.
+deleteOrphanedGraphData: |
+  UPDATE dts_graphdata
+  SET date_deleted = :date_deleted
+  WHERE k1 = k2
+  AND graph_item_type IN (:node_types)
+  AND date_deleted IS NULL
+  AND k1 NOT IN (
+      SELECT k FROM (
+          SELECT k1 AS k FROM dts_graphdata WHERE k1 != k2 AND date_deleted IS NULL
+          UNION
+          SELECT k2 AS k FROM dts_graphdata WHERE k1 != k2 AND date_deleted IS NULL
+      ) AS live
+  );
+
+purgeGraphData: |
+  DELETE FROM dts_graphdata
+  WHERE date_deleted IS NOT NULL
+  AND date_deleted < :deleted_before;
+
+createSchemaVersionTable: |
+  CREATE TABLE IF NOT EXISTS dts_schema_version(
+      version INT NOT NULL PRIMARY KEY
+  );
+
+selectSchemaVersion: |
+  SELECT MAX(version) FROM dts_schema_version;
+
+insertSchemaVersion: |
+  INSERT INTO dts_schema_version (version) VALUES (:version);
+
+deleteSchemaVersion: |
+  DELETE FROM dts_schema_version WHERE version = :version;
+
+# the trigrams of each node are replaced whenever the node is written
+insertGraphSearch: |
+  INSERT INTO dts_graphsearch (graph_item_type, k1, trigram)
+  VALUES (:graph_item_type, :k1, :trigram);
+
+deleteGraphSearch: |
+  DELETE FROM dts_graphsearch
+  WHERE (graph_item_type = :graph_item_type AND k1 = :k1);
+
+# candidates share the most trigrams with the query and are scored by the
+# graph store before being ranked by their dependents
+searchGraphData: |
+  SELECT g.graph_item_type, g.k1, g.k2, g.encoding, g.graph_item_data,
+      (SELECT COUNT(*)
+       FROM dts_graphdata AS d
+       WHERE d.k2 = g.k1
+       AND d.k1 != d.k2
+       AND d.graph_item_type IN (:dependent_types)
+       AND d.date_deleted IS NULL) AS dependents
+  FROM (
+      SELECT graph_item_type, k1
+      FROM dts_graphsearch
+      WHERE trigram IN (:trigrams)
+      AND graph_item_type IN (:graph_item_types)
+      GROUP BY graph_item_type, k1
+      ORDER BY COUNT(*) DESC, k1
+      LIMIT :candidates
+  ) AS s
+  INNER JOIN dts_graphdata AS g
+  ON g.graph_item_type = s.graph_item_type AND g.k1 = s.k1 AND g.k2 = s.k1
+  WHERE g.date_deleted IS NULL;
+
+purgeGraphSearch: |
+  DELETE FROM dts_graphsearch
+  WHERE NOT EXISTS (
+      SELECT 1
+      FROM dts_graphdata AS g
+      WHERE g.graph_item_type = dts_graphsearch.graph_item_type
+      AND g.k1 = dts_graphsearch.k1
+      AND g.k2 = dts_graphsearch.k1
+      AND g.date_deleted IS NULL
+  );
+
+# each migration is a list of statements applied in order. The position of the
+# migration in the list determines the schema version it produces.
+migrations:
+  # 1: the initial schema
+  - - *createGraphDataTable
+  # 2: indexes supporting lookups in both directions and soft-delete filtering
+  - - CREATE INDEX dts_graphdata_k1 ON dts_graphdata (k1, date_deleted);
+    - CREATE INDEX dts_graphdata_k2 ON dts_graphdata (k2, date_deleted);
+  # 3: the time each item was created to support point in time queries
+  - - ALTER TABLE dts_graphdata ADD COLUMN date_created DATETIME DEFAULT NULL;
+    - UPDATE dts_graphdata SET date_created = last_modified;
+  # 4: trigrams of the text of each node supporting search. Existing nodes are
+  # indexed by the migrate command.
+  - - |
+      CREATE TABLE IF NOT EXISTS dts_graphsearch(
+          graph_item_type VARCHAR(55),
+          k1 CHAR(64),
+          trigram VARCHAR(12),
+          PRIMARY KEY (graph_item_type, k1, trigram)
+      );
+    - CREATE INDEX dts_graphsearch_trigram ON dts_graphsearch (trigram);
 `
 
 // LoadStatementsFile loads an external yaml file containing SQL statements
@@ -94,9 +413,59 @@ func LoadStatements(contents []byte) (*Statements, error) {
 	return statements, nil
 }
 
-// DefaultStatements to use
+// Validate ensures that every statement required by the GraphStore has been
+// provided. Traversal statements are optional since traversals can fall back to
+// walking the graph one node at a time.
+func (s *Statements) Validate() error {
+	required := []struct {
+		name      string
+		statement string
+	}{
+		{"createGraphDataTable", s.CreateGraphDataTable},
+		{"insertGraphData", s.InsertGraphData},
+		{"deleteGraphData", s.DeleteGraphData},
+		{"listGraphData", s.ListGraphData},
+		{"selectGraphDataUpstreamDependencies", s.SelectGraphDataUpstreamDependencies},
+		{"selectGraphDataDownstreamDependencies", s.SelectGraphDataDownstreamDependencies},
+	}
+
+	for _, r := range required {
+		if len(r.statement) == 0 {
+			return fmt.Errorf("missing required statement: %s", r.name)
+		}
+	}
+
+	return nil
+}
+
+// builtinStatements contains the statements shipped for each supported driver.
+// Later documents override the statements defined by earlier ones.
+var builtinStatements = map[string][]string{
+	"sqlite3":  {sqlStatements},
+	"mysql":    {sqlStatements, mysqlStatements},
+	"postgres": {sqlStatements, postgresStatements},
+}
+
+// StatementsForDriver returns the built in statements for the named driver
+func StatementsForDriver(driver string) (*Statements, error) {
+	documents, ok := builtinStatements[driver]
+	if !ok {
+		return nil, fmt.Errorf("no statements available for driver: %s", driver)
+	}
+
+	statements := &Statements{}
+	for _, document := range documents {
+		if err := yaml.Unmarshal([]byte(document), statements); err != nil {
+			return nil, err
+		}
+	}
+
+	return statements, nil
+}
+
+// DefaultStatements returns the statements used by the sqlite3 driver
 func DefaultStatements() *Statements {
-	statements, err := LoadStatements([]byte(sqlStatements))
+	statements, err := StatementsForDriver("sqlite3")
 	if err != nil {
 		panic(err.Error())
 	}
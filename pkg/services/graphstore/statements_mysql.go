@@ -0,0 +1,17 @@
+package graphstore
+
+// mysqlStatements override the sqlStatements that MySQL does not support.
+// MySQL applies each assignment in order, so date_created must be assigned
+// before date_deleted is cleared.
+const mysqlStatements = `
+insertGraphData: |
+  INSERT INTO dts_graphdata
+  (graph_item_type, k1, k2, encoding, graph_item_data, last_modified, date_deleted, date_created)
+  VALUES (:graph_item_type, :k1, :k2, :encoding, :graph_item_data, :last_modified, NULL, :last_modified)
+  ON DUPLICATE KEY UPDATE
+      date_created = IF(date_deleted IS NULL, date_created, VALUES(date_created)),
+      encoding = VALUES(encoding),
+      graph_item_data = VALUES(graph_item_data),
+      last_modified = VALUES(last_modified),
+      date_deleted = NULL;
+`
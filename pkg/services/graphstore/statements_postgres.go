@@ -0,0 +1,133 @@
+package graphstore
+
+// postgresStatements override the sqlStatements that PostgreSQL does not
+// support. Keys are stored and cast as VARCHAR since PostgreSQL pads CHAR values
+// with spaces, and timestamps use TIMESTAMP since it has no DATETIME type. The
+// migrations are repeated in full since they use those column types.
+const postgresStatements = `
+maxParameters: 65535
+
+createGraphDataTable: &createGraphDataTable |
+  CREATE TABLE IF NOT EXISTS dts_graphdata(
+      graph_item_type VARCHAR(55),
+      k1 VARCHAR(64),
+      k2 VARCHAR(64),
+      encoding SMALLINT,
+      graph_item_data TEXT,
+      last_modified TIMESTAMP,
+      date_deleted TIMESTAMP DEFAULT NULL,
+      PRIMARY KEY (graph_item_type, k1, k2)
+  );
+
+selectGraphDataUpstreamTraversal: |
+  WITH RECURSIVE traversal(k) AS (
+      SELECT CAST(:key AS VARCHAR(64))
+      UNION
+      SELECT g.k2
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k1 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM traversal AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k1 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k1 = g2.k2
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataDownstreamTraversal: |
+  WITH RECURSIVE traversal(k) AS (
+      SELECT CAST(:key AS VARCHAR(64))
+      UNION
+      SELECT g.k1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k2 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM traversal AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k2 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k2 = g2.k1
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataUpstreamTraversalWithinDepth: |
+  WITH RECURSIVE traversal(k, depth) AS (
+      SELECT CAST(:key AS VARCHAR(64)), 0
+      UNION
+      SELECT g.k2, t.depth + 1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k1 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+      AND t.depth + 1 < :max_depth
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM (SELECT DISTINCT k FROM traversal) AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k1 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k1 = g2.k2
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+selectGraphDataDownstreamTraversalWithinDepth: |
+  WITH RECURSIVE traversal(k, depth) AS (
+      SELECT CAST(:key AS VARCHAR(64)), 0
+      UNION
+      SELECT g.k1, t.depth + 1
+      FROM traversal AS t
+      INNER JOIN dts_graphdata AS g ON g.k2 = t.k
+      WHERE g.graph_item_type IN (:edge_types)
+      AND g.k1 != g.k2
+      AND g.date_deleted IS NULL
+      AND t.depth + 1 < :max_depth
+  )
+  SELECT g1.graph_item_type, g1.k1, g1.k2, g1.encoding, g1.graph_item_data,
+          g2.graph_item_type, g2.k1, g2.k2, g2.encoding, g2.graph_item_data
+  FROM (SELECT DISTINCT k FROM traversal) AS t
+  INNER JOIN dts_graphdata AS g2 ON g2.k2 = t.k
+  INNER JOIN dts_graphdata AS g1 ON g1.k2 = g2.k1
+  WHERE g2.graph_item_type IN (:edge_types)
+  AND g2.k1 != g2.k2
+  AND g2.date_deleted IS NULL
+  AND g1.k1 = g1.k2
+  AND g1.date_deleted IS NULL;
+
+# each migration is a list of statements applied in order. The position of the
+# migration in the list determines the schema version it produces.
+migrations:
+  # 1: the initial schema
+  - - *createGraphDataTable
+  # 2: indexes supporting lookups in both directions and soft-delete filtering
+  - - CREATE INDEX dts_graphdata_k1 ON dts_graphdata (k1, date_deleted);
+    - CREATE INDEX dts_graphdata_k2 ON dts_graphdata (k2, date_deleted);
+  # 3: the time each item was created to support point in time queries
+  - - ALTER TABLE dts_graphdata ADD COLUMN date_created TIMESTAMP DEFAULT NULL;
+    - UPDATE dts_graphdata SET date_created = last_modified;
+  # 4: trigrams of the text of each node supporting search. Existing nodes are
+  # indexed by the migrate command.
+  - - |
+      CREATE TABLE IF NOT EXISTS dts_graphsearch(
+          graph_item_type VARCHAR(55),
+          k1 VARCHAR(64),
+          trigram VARCHAR(12),
+          PRIMARY KEY (graph_item_type, k1, trigram)
+      );
+    - CREATE INDEX dts_graphsearch_trigram ON dts_graphsearch (trigram);
+`
@@ -0,0 +1,145 @@
+package graphstore
+
+import (
+	"context"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TraverseRequest describes a transitive walk of the graph that starts at Key
+// and follows edges of the provided EdgeTypes. When MaxDepth is positive, the
+// walk stops after following that many edges.
+type TraverseRequest struct {
+	Key       []byte
+	EdgeTypes []string
+	MaxDepth  int
+}
+
+// TraversedPair is a GraphItemPair reached during a traversal. Depth is one more
+// than the distance between the starting key and the node the Edge was followed
+// from, so the pairs adjacent to the starting key have a Depth of 1.
+type TraversedPair struct {
+	Edge  *store.GraphItem
+	Node  *store.GraphItem
+	Depth int
+}
+
+// TraverseResponse contains every pair reachable from the requested key,
+// ordered by depth.
+type TraverseResponse struct {
+	Pairs []*TraversedPair
+}
+
+// Traverser is implemented by graph stores that can resolve the transitive
+// closure of a key without a round trip per node.
+type Traverser interface {
+	TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error)
+	TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error)
+}
+
+// maxBoundedTraversalDepth is the largest depth traversed using the depth
+// bounded statements. They cannot deduplicate nodes reached at different
+// depths, so their cost grows with the depth on cyclic graphs. Deeper walks use
+// the unbounded statements and drop the pairs beyond the depth afterwards.
+const maxBoundedTraversalDepth = 8
+
+var _ Traverser = &graphStore{}
+
+func (gs *graphStore) TraverseUpstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	statement := gs.statements.SelectGraphDataUpstreamTraversal
+	if req.MaxDepth > 0 && req.MaxDepth <= maxBoundedTraversalDepth {
+		statement = gs.statements.SelectGraphDataUpstreamTraversalWithinDepth
+	}
+	return gs.traverse(ctx, statement, req, false)
+}
+
+func (gs *graphStore) TraverseDownstream(ctx context.Context, req *TraverseRequest) (*TraverseResponse, error) {
+	statement := gs.statements.SelectGraphDataDownstreamTraversal
+	if req.MaxDepth > 0 && req.MaxDepth <= maxBoundedTraversalDepth {
+		statement = gs.statements.SelectGraphDataDownstreamTraversalWithinDepth
+	}
+	return gs.traverse(ctx, statement, req, true)
+}
+
+func (gs *graphStore) traverse(ctx context.Context, statement string, req *TraverseRequest, downstream bool) (*TraverseResponse, error) {
+	// historical traversals fall back to walking the graph one node at a time
+	if len(statement) == 0 || AsOf(ctx) != nil {
+		return nil, api.ErrUnimplemented
+	}
+
+	query, args, err := sqlx.Named(statement, map[string]interface{}{
+		"key":        Base64encode(req.Key),
+		"edge_types": req.EdgeTypes,
+		"max_depth":  req.MaxDepth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := gs.queryContext(ctx)
+	defer cancel()
+
+	rows, err := gs.rodb.QueryxContext(queryCtx, gs.rodb.Rebind(query), args...)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
+	pairs, err := readGraphItemPairs(rows)
+	if err != nil {
+		return nil, queryError(queryCtx, err)
+	}
+
+	return &TraverseResponse{
+		Pairs: measureDepth(req.Key, pairs, req.MaxDepth, downstream),
+	}, nil
+}
+
+// measureDepth orders the provided pairs breadth first starting at key,
+// recording the depth at which each pair was reached. Pairs that are not
+// reachable from key within maxDepth (when positive) are dropped.
+func measureDepth(key []byte, pairs []*store.GraphItemPair, maxDepth int, downstream bool) []*TraversedPair {
+	children := make(map[string][]*store.GraphItemPair)
+	for _, pair := range pairs {
+		parent := pair.GetEdge().GetK1()
+		if downstream {
+			parent = pair.GetEdge().GetK2()
+		}
+		children[string(parent)] = append(children[string(parent)], pair)
+	}
+
+	results := make([]*TraversedPair, 0, len(pairs))
+	visited := map[string]bool{string(key): true}
+	frontier := [][]byte{key}
+
+	for depth := 1; len(frontier) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+		next := make([][]byte, 0)
+
+		for _, parent := range frontier {
+			for _, pair := range children[string(parent)] {
+				results = append(results, &TraversedPair{
+					Edge:  pair.GetEdge(),
+					Node:  pair.GetNode(),
+					Depth: depth,
+				})
+
+				node := pair.GetNode().GetK1()
+				if !visited[string(node)] {
+					visited[string(node)] = true
+					next = append(next, node)
+				}
+			}
+		}
+
+		frontier = next
+	}
+
+	return results
+}
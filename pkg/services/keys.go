@@ -7,6 +7,7 @@ import (
 	"github.com/deps-cloud/api/v1alpha/schema"
 	"github.com/deps-cloud/api/v1alpha/store"
 	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+	"github.com/deps-cloud/tracker/pkg/types"
 )
 
 func key(vars ...string) []byte {
@@ -25,6 +26,14 @@ func keyForModule(module *schema.Module) []byte {
 	return key(module.GetLanguage(), module.GetOrganization(), module.GetModule())
 }
 
+func keyForRevision(revision *Revision) []byte {
+	return key(revision.GetSource().GetUrl(), revision.GetId())
+}
+
+func keyForRevisionSummary(summary *RevisionSummary) []byte {
+	return key(types.RevisionSummaryType, summary.GetSource().GetUrl(), summary.GetId())
+}
+
 func readableKey(item *store.GraphItem) string {
 	return strings.Join([]string{
 		item.GetGraphItemType(),
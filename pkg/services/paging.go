@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// pageTokenHeader is the request header used to continue a listing after
+	// the last item of the previous page.
+	pageTokenHeader = "x-page-token"
+	// nextPageTokenHeader is the response header containing the token for the
+	// next page of a listing. It is omitted once the last page is returned.
+	nextPageTokenHeader = "x-next-page-token"
+	// totalCountHeader is the response header containing the number of items
+	// matching a listing across every page.
+	totalCountHeader = "x-total-count"
+
+	// languageHeader is the request header used to list the modules of a language
+	languageHeader = "x-filter-language"
+	// organizationHeader is the request header used to list the modules of an
+	// organization
+	organizationHeader = "x-filter-organization"
+	// modulePrefixHeader is the request header used to list the modules whose
+	// name starts with the provided value
+	modulePrefixHeader = "x-filter-module-prefix"
+	// urlPrefixHeader is the request header used to list the sources whose url
+	// starts with the provided value
+	urlPrefixHeader = "x-filter-url-prefix"
+)
+
+// listFilter maps a request header onto a field of the listed items.
+type listFilter struct {
+	header string
+	field  string
+	prefix bool
+}
+
+var moduleFilters = []listFilter{
+	{header: languageHeader, field: "language"},
+	{header: organizationHeader, field: "organization"},
+	{header: modulePrefixHeader, field: "module", prefix: true},
+}
+
+var sourceFilters = []listFilter{
+	{header: urlPrefixHeader, field: "url", prefix: true},
+}
+
+// scanFilters reads the filters provided in the request headers.
+func scanFilters(md metadata.MD, filters []listFilter) []*graphstore.ScanFilter {
+	results := make([]*graphstore.ScanFilter, 0, len(filters))
+	for _, filter := range filters {
+		if values := md.Get(filter.header); len(values) > 0 && len(values[0]) > 0 {
+			results = append(results, &graphstore.ScanFilter{
+				Field:  filter.field,
+				Value:  values[0],
+				Prefix: filter.prefix,
+			})
+		}
+	}
+	return results
+}
+
+// listItems returns a page of the items of the provided type along with the
+// page size that was used. The first page and pages requested using the
+// pageTokenHeader are read using continuation tokens when the graph store
+// supports them, which is required to filter the items. Other pages are
+// located using the page number.
+func listItems(ctx context.Context, gs store.GraphStoreClient, graphItemType string, req *tracker.ListRequest, filters []listFilter) ([]*store.GraphItem, int32, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token := ""
+	if values := md.Get(pageTokenHeader); len(values) > 0 {
+		token = values[0]
+	}
+
+	itemFilters := scanFilters(md, filters)
+
+	if scanner, ok := gs.(graphstore.Scanner); ok && (len(token) > 0 || req.GetPage() <= 1) {
+		resp, err := scanner.Scan(ctx, &graphstore.ScanRequest{
+			Type:    graphItemType,
+			Count:   req.GetCount(),
+			Filters: itemFilters,
+			Token:   token,
+		})
+
+		if err == nil {
+			reportPage(ctx, resp)
+			return resp.Items, resp.Count, nil
+		} else if err != api.ErrUnimplemented {
+			return nil, 0, err
+		}
+	}
+
+	if len(itemFilters) > 0 && req.GetPage() > 1 {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "filtered listings must be paged using %s", pageTokenHeader)
+	} else if len(token) > 0 || len(itemFilters) > 0 {
+		return nil, 0, api.ErrUnimplemented
+	}
+
+	resp, err := gs.List(ctx, &store.ListRequest{
+		Page:  req.GetPage(),
+		Count: req.GetCount(),
+		Type:  graphItemType,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.GetItems(), graphstore.ScanCount(req.GetCount()), nil
+}
+
+// reportPage returns the token for the next page and the total number of items
+// to the caller using the nextPageTokenHeader and totalCountHeader.
+func reportPage(ctx context.Context, resp *graphstore.ScanResponse) {
+	header := metadata.MD{}
+	if len(resp.NextToken) > 0 {
+		header.Set(nextPageTokenHeader, resp.NextToken)
+	}
+	if resp.Total >= 0 {
+		header.Set(totalCountHeader, strconv.FormatInt(resp.Total, 10))
+	}
+
+	if len(header) == 0 {
+		return
+	}
+
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		logrus.Debugf("[service.paging] failed to report page: %s", err.Error())
+	}
+}
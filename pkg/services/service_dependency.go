@@ -23,15 +23,24 @@ type dependencyService struct {
 
 var _ tracker.DependencyServiceServer = &dependencyService{}
 
-func keyForDependencyRequest(req *tracker.DependencyRequest) []byte {
-	return keyForModule(&schema.Module{
+func moduleForDependencyRequest(req *tracker.DependencyRequest) *schema.Module {
+	return &schema.Module{
 		Language:     req.GetLanguage(),
 		Organization: req.GetOrganization(),
 		Module:       req.GetModule(),
-	})
+	}
+}
+
+func keyForDependencyRequest(req *tracker.DependencyRequest) []byte {
+	return keyForModule(moduleForDependencyRequest(req))
 }
 
 func (d *dependencyService) ListDependents(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependentsResponse, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	key := keyForDependencyRequest(req)
 
 	response, err := d.gs.FindDownstream(ctx, &store.FindRequest{
@@ -60,6 +69,11 @@ func (d *dependencyService) ListDependents(ctx context.Context, req *tracker.Dep
 }
 
 func (d *dependencyService) ListDependencies(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependenciesResponse, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	key := keyForDependencyRequest(req)
 
 	response, err := d.gs.FindUpstream(ctx, &store.FindRequest{
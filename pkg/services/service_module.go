@@ -26,31 +26,36 @@ type moduleService struct {
 var _ tracker.ModuleServiceServer = &moduleService{}
 
 func (s *moduleService) List(ctx context.Context, req *tracker.ListRequest) (*tracker.ListModuleResponse, error) {
-	resp, err := s.gs.List(ctx, &store.ListRequest{
-		Page:  req.GetPage(),
-		Count: req.GetCount(),
-		Type:  types.ModuleType,
-	})
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	items, count, err := listItems(ctx, s.gs, types.ModuleType, req, moduleFilters)
 	if err != nil {
 		logrus.Errorf("[service.module] %s", err.Error())
 		return nil, err
 	}
 
-	modules := make([]*schema.Module, 0, len(resp.GetItems()))
-	for _, item := range resp.GetItems() {
+	modules := make([]*schema.Module, 0, len(items))
+	for _, item := range items {
 		module, _ := Decode(item)
 		modules = append(modules, module.(*schema.Module))
 	}
 
 	return &tracker.ListModuleResponse{
 		Page:    req.GetPage(),
-		Count:   req.GetCount(),
+		Count:   count,
 		Modules: modules,
 	}, nil
 }
 
 func (s *moduleService) ListSources(ctx context.Context, req *schema.Module) (*tracker.ListSourcesResponse, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	key := keyForModule(req)
 
 	response, err := s.gs.FindDownstream(ctx, &store.FindRequest{
@@ -79,6 +84,11 @@ func (s *moduleService) ListSources(ctx context.Context, req *schema.Module) (*t
 }
 
 func (s *moduleService) ListManaged(ctx context.Context, req *schema.Source) (*tracker.ListManagedResponse, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	key := keyForSource(req)
 
 	response, err := s.gs.FindUpstream(ctx, &store.FindRequest{
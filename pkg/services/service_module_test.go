@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/tracker"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestModuleService_List_pages(t *testing.T) {
+	gs := newTestGraphStoreClient(t, "TestModuleService_List_pages")
+	trackDiamond(t, gs)
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer()
+	RegisterModuleService(server, gs)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	client := tracker.NewModuleServiceClient(conn)
+
+	header := metadata.MD{}
+	first, err := client.List(context.Background(), &tracker.ListRequest{Count: 3}, grpc.Header(&header))
+	require.Nil(t, err)
+	require.Equal(t, int32(3), first.GetCount())
+	require.Len(t, first.GetModules(), 3)
+	require.Len(t, header.Get(nextPageTokenHeader), 1)
+	require.Equal(t, []string{"4"}, header.Get(totalCountHeader))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), pageTokenHeader, header.Get(nextPageTokenHeader)[0])
+
+	header = metadata.MD{}
+	second, err := client.List(ctx, &tracker.ListRequest{Count: 3}, grpc.Header(&header))
+	require.Nil(t, err)
+	require.Len(t, second.GetModules(), 1)
+	require.Len(t, header.Get(nextPageTokenHeader), 0)
+
+	names := make([]string, 0, 4)
+	for _, module := range append(first.GetModules(), second.GetModules()...) {
+		names = append(names, module.GetModule())
+	}
+	require.ElementsMatch(t, []string{"a", "b", "c", "d"}, names)
+
+	// pages located by number use the same page size as the first page
+	numbered, err := client.List(context.Background(), &tracker.ListRequest{Page: 2, Count: 3})
+	require.Nil(t, err)
+	require.Equal(t, int32(3), numbered.GetCount())
+	require.Len(t, numbered.GetModules(), 1)
+	require.Equal(t, second.GetModules()[0].GetModule(), numbered.GetModules()[0].GetModule())
+
+	numbered, err = client.List(context.Background(), &tracker.ListRequest{Page: 2})
+	require.Nil(t, err)
+	require.Equal(t, int32(10), numbered.GetCount())
+	require.Len(t, numbered.GetModules(), 0)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(),
+		languageHeader, "go",
+		organizationHeader, "deps-cloud",
+		modulePrefixHeader, "b")
+
+	header = metadata.MD{}
+	filtered, err := client.List(ctx, &tracker.ListRequest{}, grpc.Header(&header))
+	require.Nil(t, err)
+	require.Len(t, filtered.GetModules(), 1)
+	require.Equal(t, "b", filtered.GetModules()[0].GetModule())
+	require.Equal(t, []string{"1"}, header.Get(totalCountHeader))
+
+	_, err = client.List(ctx, &tracker.ListRequest{Page: 2})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,623 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+	"github.com/deps-cloud/tracker/pkg/types"
+
+	"github.com/gogo/protobuf/proto"
+	ptypes "github.com/gogo/protobuf/types"
+
+	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The RevisionService is not yet part of the published api. Until it is, the
+// service and its messages are described by hand.
+const revisionServiceName = "cloud.deps.api.v1alpha.tracker.RevisionService"
+
+// ErrRevisionNotFound occurs when a revision cannot be found for a source
+var ErrRevisionNotFound = status.Error(codes.NotFound, "failed to locate revision")
+
+// maxRevisions is the number of revisions retained for each source. The oldest
+// revisions are deleted as new ones are recorded and are purged by garbage
+// collection like any other deleted row.
+const maxRevisions = 100
+
+// RevisionEdge is an edge of a source's dependency graph. Manages edges link
+// the source to the Module it manages. Depends edges link the Module to the
+// Dependency it depends on.
+type RevisionEdge struct {
+	Module     *schema.Module  `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	Manages    *schema.Manages `protobuf:"bytes,2,opt,name=manages,proto3" json:"manages,omitempty"`
+	Dependency *schema.Module  `protobuf:"bytes,3,opt,name=dependency,proto3" json:"dependency,omitempty"`
+	Depends    *schema.Depends `protobuf:"bytes,4,opt,name=depends,proto3" json:"depends,omitempty"`
+}
+
+// Reset clears the revision edge
+func (m *RevisionEdge) Reset() { *m = RevisionEdge{} }
+
+// String formats the revision edge using the protobuf text format
+func (m *RevisionEdge) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RevisionEdge as a protobuf message
+func (*RevisionEdge) ProtoMessage() {}
+
+// GetModule returns the module managed by the source or depending on the Dependency
+func (m *RevisionEdge) GetModule() *schema.Module {
+	if m != nil {
+		return m.Module
+	}
+	return nil
+}
+
+// GetDependency returns the module depended on by the Module, if any
+func (m *RevisionEdge) GetDependency() *schema.Module {
+	if m != nil {
+		return m.Dependency
+	}
+	return nil
+}
+
+// Revision records the edges added to and removed from the graph of a source
+// by a single call to Track.
+type Revision struct {
+	Id        string            `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Source    *schema.Source    `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	Timestamp *ptypes.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Added     []*RevisionEdge   `protobuf:"bytes,4,rep,name=added,proto3" json:"added,omitempty"`
+	Removed   []*RevisionEdge   `protobuf:"bytes,5,rep,name=removed,proto3" json:"removed,omitempty"`
+}
+
+// Reset clears the revision
+func (m *Revision) Reset() { *m = Revision{} }
+
+// String formats the revision using the protobuf text format
+func (m *Revision) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks Revision as a protobuf message
+func (*Revision) ProtoMessage() {}
+
+// GetId returns the identifier of the revision
+func (m *Revision) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// GetSource returns the source the revision was recorded for
+func (m *Revision) GetSource() *schema.Source {
+	if m != nil {
+		return m.Source
+	}
+	return nil
+}
+
+// GetAdded returns the edges added by the revision
+func (m *Revision) GetAdded() []*RevisionEdge {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+// GetRemoved returns the edges removed by the revision
+func (m *Revision) GetRemoved() []*RevisionEdge {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+// RevisionSummary identifies a Revision without the edges it records. A summary
+// is stored alongside each revision so that the oldest revisions can be found
+// without reading every revision of the source.
+type RevisionSummary struct {
+	Id        string            `json:"id,omitempty"`
+	Source    *schema.Source    `json:"source,omitempty"`
+	Timestamp *ptypes.Timestamp `json:"timestamp,omitempty"`
+}
+
+// GetId returns the identifier of the summarized revision
+func (m *RevisionSummary) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// GetSource returns the source the summarized revision was recorded for
+func (m *RevisionSummary) GetSource() *schema.Source {
+	if m != nil {
+		return m.Source
+	}
+	return nil
+}
+
+// ListRevisionsRequest asks for the revisions recorded for a source.
+type ListRevisionsRequest struct {
+	Source *schema.Source `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+}
+
+// Reset clears the request
+func (m *ListRevisionsRequest) Reset() { *m = ListRevisionsRequest{} }
+
+// String formats the request using the protobuf text format
+func (m *ListRevisionsRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ListRevisionsRequest as a protobuf message
+func (*ListRevisionsRequest) ProtoMessage() {}
+
+// ListRevisionsResponse contains the revisions of a source, oldest first.
+type ListRevisionsResponse struct {
+	Revisions []*Revision `protobuf:"bytes,1,rep,name=revisions,proto3" json:"revisions,omitempty"`
+}
+
+// Reset clears the response
+func (m *ListRevisionsResponse) Reset() { *m = ListRevisionsResponse{} }
+
+// String formats the response using the protobuf text format
+func (m *ListRevisionsResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ListRevisionsResponse as a protobuf message
+func (*ListRevisionsResponse) ProtoMessage() {}
+
+// GetRevisions returns the revisions of the source
+func (m *ListRevisionsResponse) GetRevisions() []*Revision {
+	if m != nil {
+		return m.Revisions
+	}
+	return nil
+}
+
+// DiffRevisionsRequest asks for the changes made to the graph of a source
+// after revision From up to and including revision To. An empty From diffs
+// from before the oldest retained revision and an empty To diffs against the
+// latest revision.
+type DiffRevisionsRequest struct {
+	Source *schema.Source `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	From   string         `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To     string         `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+}
+
+// Reset clears the request
+func (m *DiffRevisionsRequest) Reset() { *m = DiffRevisionsRequest{} }
+
+// String formats the request using the protobuf text format
+func (m *DiffRevisionsRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks DiffRevisionsRequest as a protobuf message
+func (*DiffRevisionsRequest) ProtoMessage() {}
+
+// DiffRevisionsResponse contains the net edges added and removed between two
+// revisions.
+type DiffRevisionsResponse struct {
+	Added   []*RevisionEdge `protobuf:"bytes,1,rep,name=added,proto3" json:"added,omitempty"`
+	Removed []*RevisionEdge `protobuf:"bytes,2,rep,name=removed,proto3" json:"removed,omitempty"`
+}
+
+// Reset clears the response
+func (m *DiffRevisionsResponse) Reset() { *m = DiffRevisionsResponse{} }
+
+// String formats the response using the protobuf text format
+func (m *DiffRevisionsResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks DiffRevisionsResponse as a protobuf message
+func (*DiffRevisionsResponse) ProtoMessage() {}
+
+// GetAdded returns the edges added between the revisions
+func (m *DiffRevisionsResponse) GetAdded() []*RevisionEdge {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+// GetRemoved returns the edges removed between the revisions
+func (m *DiffRevisionsResponse) GetRemoved() []*RevisionEdge {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+// RevisionServiceClient audits how the dependency graph of a source changed
+// over time.
+type RevisionServiceClient interface {
+	ListRevisions(ctx context.Context, in *ListRevisionsRequest, opts ...grpc.CallOption) (*ListRevisionsResponse, error)
+	DiffRevisions(ctx context.Context, in *DiffRevisionsRequest, opts ...grpc.CallOption) (*DiffRevisionsResponse, error)
+}
+
+// NewRevisionServiceClient constructs a RevisionServiceClient using the connection
+func NewRevisionServiceClient(cc *grpc.ClientConn) RevisionServiceClient {
+	return &revisionServiceClient{cc: cc}
+}
+
+type revisionServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *revisionServiceClient) ListRevisions(ctx context.Context, in *ListRevisionsRequest, opts ...grpc.CallOption) (*ListRevisionsResponse, error) {
+	out := &ListRevisionsResponse{}
+	if err := c.cc.Invoke(ctx, "/"+revisionServiceName+"/ListRevisions", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *revisionServiceClient) DiffRevisions(ctx context.Context, in *DiffRevisionsRequest, opts ...grpc.CallOption) (*DiffRevisionsResponse, error) {
+	out := &DiffRevisionsResponse{}
+	if err := c.cc.Invoke(ctx, "/"+revisionServiceName+"/DiffRevisions", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type revisionServiceServer interface {
+	ListRevisions(context.Context, *ListRevisionsRequest) (*ListRevisionsResponse, error)
+	DiffRevisions(context.Context, *DiffRevisionsRequest) (*DiffRevisionsResponse, error)
+}
+
+var revisionServiceDesc = grpc.ServiceDesc{
+	ServiceName: revisionServiceName,
+	HandlerType: (*revisionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRevisions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &ListRevisionsRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(revisionServiceServer).ListRevisions(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + revisionServiceName + "/ListRevisions"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(revisionServiceServer).ListRevisions(ctx, req.(*ListRevisionsRequest))
+				})
+			},
+		},
+		{
+			MethodName: "DiffRevisions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &DiffRevisionsRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(revisionServiceServer).DiffRevisions(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + revisionServiceName + "/DiffRevisions"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(revisionServiceServer).DiffRevisions(ctx, req.(*DiffRevisionsRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// RegisterRevisionService registers the revisionService implementation with the server
+func RegisterRevisionService(server *grpc.Server, gs store.GraphStoreClient) {
+	server.RegisterService(&revisionServiceDesc, &revisionService{gs: gs})
+}
+
+type revisionService struct {
+	gs store.GraphStoreClient
+}
+
+var _ revisionServiceServer = &revisionService{}
+
+// listRevisions returns the revisions recorded for the source, oldest first.
+func listRevisions(ctx context.Context, gs store.GraphStoreClient, source *schema.Source) ([]*Revision, error) {
+	resp, err := gs.FindUpstream(ctx, &store.FindRequest{
+		Key:       keyForSource(source),
+		EdgeTypes: []string{types.RecordsType},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, 0, len(resp.GetPairs()))
+	for _, pair := range resp.GetPairs() {
+		revision, err := Decode(pair.GetNode())
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision.(*Revision))
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return timestampBefore(revisions[i].Timestamp, revisions[j].Timestamp)
+	})
+
+	return revisions, nil
+}
+
+// timestampBefore reports whether a is earlier than b.
+func timestampBefore(a, b *ptypes.Timestamp) bool {
+	if a.GetSeconds() != b.GetSeconds() {
+		return a.GetSeconds() < b.GetSeconds()
+	}
+	return a.GetNanos() < b.GetNanos()
+}
+
+// list returns the revisions of the source as of the point in time requested
+// by the caller.
+func (r *revisionService) list(ctx context.Context, source *schema.Source) ([]*Revision, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return listRevisions(ctx, r.gs, source)
+}
+
+func (r *revisionService) ListRevisions(ctx context.Context, req *ListRevisionsRequest) (*ListRevisionsResponse, error) {
+	revisions, err := r.list(ctx, req.Source)
+	if err != nil {
+		logrus.Errorf("[service.revision] %s", err.Error())
+		return nil, err
+	}
+
+	return &ListRevisionsResponse{Revisions: revisions}, nil
+}
+
+func (r *revisionService) DiffRevisions(ctx context.Context, req *DiffRevisionsRequest) (*DiffRevisionsResponse, error) {
+	revisions, err := r.list(ctx, req.Source)
+	if err != nil {
+		logrus.Errorf("[service.revision] %s", err.Error())
+		return nil, err
+	}
+
+	// from is exclusive, so an empty From starts before the first revision
+	from, to := -1, len(revisions)-1
+	foundFrom, foundTo := req.From == "", req.To == ""
+
+	for i, revision := range revisions {
+		if revision.GetId() == req.From {
+			from, foundFrom = i, true
+		}
+		if revision.GetId() == req.To {
+			to, foundTo = i, true
+		}
+	}
+
+	if !foundFrom || !foundTo {
+		return nil, ErrRevisionNotFound
+	}
+
+	if from > to {
+		added, removed := diffRevisions(revisions[to+1 : from+1])
+		return &DiffRevisionsResponse{Added: removed, Removed: added}, nil
+	}
+
+	added, removed := diffRevisions(revisions[from+1 : to+1])
+	return &DiffRevisionsResponse{Added: added, Removed: removed}, nil
+}
+
+// diffRevisions replays the revisions in order, returning the net edges that
+// they added and removed. Edges added and later removed cancel out.
+func diffRevisions(revisions []*Revision) ([]*RevisionEdge, []*RevisionEdge) {
+	added := make(map[string]*RevisionEdge)
+	removed := make(map[string]*RevisionEdge)
+
+	for _, revision := range revisions {
+		for _, edge := range revision.GetRemoved() {
+			key := edge.String()
+			if _, ok := added[key]; ok {
+				delete(added, key)
+			} else {
+				removed[key] = edge
+			}
+		}
+
+		for _, edge := range revision.GetAdded() {
+			key := edge.String()
+			if _, ok := removed[key]; ok {
+				delete(removed, key)
+			} else {
+				added[key] = edge
+			}
+		}
+	}
+
+	return sortedEdges(added), sortedEdges(removed)
+}
+
+func sortedEdges(idx map[string]*RevisionEdge) []*RevisionEdge {
+	keys := make([]string, 0, len(idx))
+	for key := range idx {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	edges := make([]*RevisionEdge, len(keys))
+	for i, key := range keys {
+		edges[i] = idx[key]
+	}
+	return edges
+}
+
+// newRevision records the edges that differ between the current and proposed
+// graphs of a source. Edges whose data changed are both removed and added. The
+// returned items store the revision and link it to the source, and are empty
+// when no edge changed.
+func newRevision(source *schema.Source, current, proposed map[string]*store.GraphItem, timestamp time.Time) ([]*store.GraphItem, error) {
+	ts, err := ptypes.TimestampProto(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]*schema.Module)
+	for _, set := range []map[string]*store.GraphItem{current, proposed} {
+		for _, item := range set {
+			if item.GetGraphItemType() != types.ModuleType {
+				continue
+			}
+
+			module, err := Decode(item)
+			if err != nil {
+				return nil, err
+			}
+			modules[graphstore.Base64encode(item.GetK1())] = module.(*schema.Module)
+		}
+	}
+
+	added, err := changedEdges(proposed, current, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := changedEdges(current, proposed, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	// graphs whose edges did not change do not need a revision
+	if len(added) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+
+	return revisionItems(&Revision{
+		Id:        strconv.FormatInt(timestamp.UnixNano(), 10),
+		Source:    source,
+		Timestamp: ts,
+		Added:     added,
+		Removed:   removed,
+	})
+}
+
+// revisionItems returns the node storing the revision, the node storing its
+// summary, and the edges linking both to its source. Only the keys are read
+// when the revision does not record any edges, which is enough to delete it.
+func revisionItems(revision *Revision) ([]*store.GraphItem, error) {
+	node, err := Encode(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := Encode(&RevisionSummary{
+		Id:        revision.GetId(),
+		Source:    revision.GetSource(),
+		Timestamp: revision.Timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sourceKey := keyForSource(revision.GetSource())
+
+	return []*store.GraphItem{
+		node,
+		{
+			GraphItemType: types.RecordsType,
+			K1:            sourceKey,
+			K2:            node.GetK1(),
+			Encoding:      store.GraphItemEncoding_JSON,
+			GraphItemData: []byte("{}"),
+		},
+		summary,
+		{
+			GraphItemType: types.RetainsType,
+			K1:            sourceKey,
+			K2:            summary.GetK1(),
+			Encoding:      store.GraphItemEncoding_JSON,
+			GraphItemData: []byte("{}"),
+		},
+	}, nil
+}
+
+// expiredRevisions returns the items of the oldest revisions of the source that
+// must be deleted to make room for a new revision. Only the summaries of the
+// revisions are read.
+func expiredRevisions(ctx context.Context, gs store.GraphStoreClient, source *schema.Source) ([]*store.GraphItem, error) {
+	resp, err := gs.FindUpstream(ctx, &store.FindRequest{
+		Key:       keyForSource(source),
+		EdgeTypes: []string{types.RetainsType},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*RevisionSummary, 0, len(resp.GetPairs()))
+	for _, pair := range resp.GetPairs() {
+		summary, err := Decode(pair.GetNode())
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary.(*RevisionSummary))
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return timestampBefore(summaries[i].Timestamp, summaries[j].Timestamp)
+	})
+
+	expired := make([]*store.GraphItem, 0)
+	for i := 0; i <= len(summaries)-maxRevisions; i++ {
+		items, err := revisionItems(&Revision{
+			Id:        summaries[i].GetId(),
+			Source:    source,
+			Timestamp: summaries[i].Timestamp,
+		})
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, items...)
+	}
+
+	return expired, nil
+}
+
+// changedEdges returns the edges in a that are missing from b or whose data
+// differs from the edge in b.
+func changedEdges(a, b map[string]*store.GraphItem, modules map[string]*schema.Module) ([]*RevisionEdge, error) {
+	idx := make(map[string]*RevisionEdge)
+
+	for key, item := range a {
+		itemType := item.GetGraphItemType()
+		if itemType != types.ManagesType && itemType != types.DependsType {
+			continue
+		}
+
+		if other, ok := b[key]; ok && bytes.Equal(item.GetGraphItemData(), other.GetGraphItemData()) {
+			continue
+		}
+
+		decoded, err := Decode(item)
+		if err != nil {
+			return nil, err
+		}
+
+		var edge *RevisionEdge
+		switch data := decoded.(type) {
+		case *schema.Manages:
+			edge = &RevisionEdge{
+				Module:  modules[graphstore.Base64encode(item.GetK2())],
+				Manages: data,
+			}
+		case *schema.Depends:
+			edge = &RevisionEdge{
+				Module:     modules[graphstore.Base64encode(item.GetK1())],
+				Dependency: modules[graphstore.Base64encode(item.GetK2())],
+				Depends:    data,
+			}
+		}
+
+		idx[edge.String()] = edge
+	}
+
+	return sortedEdges(idx), nil
+}
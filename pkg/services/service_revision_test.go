@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/deps"
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/types"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dependencyNames(edges []*RevisionEdge) []string {
+	names := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		if edge.GetDependency() != nil {
+			names = append(names, edge.GetDependency().GetModule())
+		} else {
+			names = append(names, "manages:"+edge.GetModule().GetModule())
+		}
+	}
+	return names
+}
+
+func TestRevisionService(t *testing.T) {
+	gs := newTestGraphStoreClient(t, "TestRevisionService")
+	sources := &sourceService{gs: gs}
+	source := &schema.Source{Url: "https://example.com/a.git"}
+
+	for _, file := range []*deps.DependencyManagementFile{
+		managementFile("a", "b", "c"),
+		managementFile("a", "c", "d"),
+	} {
+		_, err := sources.Track(context.Background(), &tracker.SourceRequest{
+			Source:          source,
+			ManagementFiles: []*deps.DependencyManagementFile{file},
+		})
+		require.Nil(t, err)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer()
+	RegisterRevisionService(server, gs)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	client := NewRevisionServiceClient(conn)
+
+	list, err := client.ListRevisions(context.Background(), &ListRevisionsRequest{Source: source})
+	require.Nil(t, err)
+
+	revisions := list.GetRevisions()
+	require.Len(t, revisions, 2)
+	require.Equal(t, source.GetUrl(), revisions[0].GetSource().GetUrl())
+	require.ElementsMatch(t, []string{"manages:a", "b", "c"}, dependencyNames(revisions[0].GetAdded()))
+	require.Len(t, revisions[0].GetRemoved(), 0)
+	require.Equal(t, []string{"d"}, dependencyNames(revisions[1].GetAdded()))
+	require.Equal(t, []string{"b"}, dependencyNames(revisions[1].GetRemoved()))
+
+	diff, err := client.DiffRevisions(context.Background(), &DiffRevisionsRequest{
+		Source: source,
+		From:   revisions[0].GetId(),
+		To:     revisions[1].GetId(),
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"d"}, dependencyNames(diff.GetAdded()))
+	require.Equal(t, []string{"b"}, dependencyNames(diff.GetRemoved()))
+
+	// diffing backwards undoes the changes
+	diff, err = client.DiffRevisions(context.Background(), &DiffRevisionsRequest{
+		Source: source,
+		From:   revisions[1].GetId(),
+		To:     revisions[0].GetId(),
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"b"}, dependencyNames(diff.GetAdded()))
+	require.Equal(t, []string{"d"}, dependencyNames(diff.GetRemoved()))
+
+	// edges added and removed between the revisions cancel out
+	diff, err = client.DiffRevisions(context.Background(), &DiffRevisionsRequest{Source: source})
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{"manages:a", "c", "d"}, dependencyNames(diff.GetAdded()))
+	require.Len(t, diff.GetRemoved(), 0)
+
+	_, err = client.DiffRevisions(context.Background(), &DiffRevisionsRequest{Source: source, From: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestRevisionService_retention(t *testing.T) {
+	gs := newTestGraphStoreClient(t, "TestRevisionService_retention")
+	sources := &sourceService{gs: gs}
+	source := &schema.Source{Url: "https://example.com/a.git"}
+
+	track := func(file *deps.DependencyManagementFile) {
+		_, err := sources.Track(context.Background(), &tracker.SourceRequest{
+			Source:          source,
+			ManagementFiles: []*deps.DependencyManagementFile{file},
+		})
+		require.Nil(t, err)
+	}
+
+	// tracking an unchanged graph does not record a revision
+	track(managementFile("a", "b"))
+	track(managementFile("a", "b"))
+
+	revisions, err := listRevisions(context.Background(), gs, source)
+	require.Nil(t, err)
+	require.Len(t, revisions, 1)
+	first := revisions[0].GetId()
+
+	// the oldest revisions are deleted once the source has too many
+	for i := 0; i < maxRevisions; i++ {
+		if i%2 == 0 {
+			track(managementFile("a", "c"))
+		} else {
+			track(managementFile("a", "b"))
+		}
+	}
+
+	revisions, err = listRevisions(context.Background(), gs, source)
+	require.Nil(t, err)
+	require.Len(t, revisions, maxRevisions)
+	require.NotEqual(t, first, revisions[0].GetId())
+
+	// the summaries of the deleted revisions are deleted with them
+	summaries, err := gs.FindUpstream(context.Background(), &store.FindRequest{
+		Key:       keyForSource(source),
+		EdgeTypes: []string{types.RetainsType},
+	})
+	require.Nil(t, err)
+	require.Len(t, summaries.GetPairs(), maxRevisions)
+	for _, pair := range summaries.GetPairs() {
+		summary, err := Decode(pair.GetNode())
+		require.Nil(t, err)
+		require.NotEqual(t, first, summary.(*RevisionSummary).GetId())
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+	"github.com/deps-cloud/tracker/pkg/types"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The SearchService is not yet part of the published api. Until it is, the
+// service and its messages are described by hand.
+const searchServiceName = "cloud.deps.api.v1alpha.tracker.SearchService"
+
+// SearchRequest looks up modules and sources by name. Each word of the Query
+// may match a word of the language, organization, and module of a module or
+// of the url of a source. Words match exactly, as prefixes, as substrings, or
+// despite typos. Type restricts the results to either modules or sources.
+type SearchRequest struct {
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Type  string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Count int32  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+// Reset clears the request
+func (m *SearchRequest) Reset() { *m = SearchRequest{} }
+
+// String formats the request using the protobuf text format
+func (m *SearchRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks SearchRequest as a protobuf message
+func (*SearchRequest) ProtoMessage() {}
+
+// SearchResult is a module or source matching the query.
+type SearchResult struct {
+	Module *schema.Module `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	Source *schema.Source `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	// Dependents is the number of modules depending on the module
+	Dependents int64 `protobuf:"varint,3,opt,name=dependents,proto3" json:"dependents,omitempty"`
+	// Score measures how closely the result matches the query, between 0 and 1
+	Score float64 `protobuf:"fixed64,4,opt,name=score,proto3" json:"score,omitempty"`
+}
+
+// Reset clears the result
+func (m *SearchResult) Reset() { *m = SearchResult{} }
+
+// String formats the result using the protobuf text format
+func (m *SearchResult) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks SearchResult as a protobuf message
+func (*SearchResult) ProtoMessage() {}
+
+// GetModule returns the matching module, if any
+func (m *SearchResult) GetModule() *schema.Module {
+	if m != nil {
+		return m.Module
+	}
+	return nil
+}
+
+// GetSource returns the matching source, if any
+func (m *SearchResult) GetSource() *schema.Source {
+	if m != nil {
+		return m.Source
+	}
+	return nil
+}
+
+// SearchResponse contains the results with the most dependents first.
+type SearchResponse struct {
+	Results []*SearchResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+// Reset clears the response
+func (m *SearchResponse) Reset() { *m = SearchResponse{} }
+
+// String formats the response using the protobuf text format
+func (m *SearchResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks SearchResponse as a protobuf message
+func (*SearchResponse) ProtoMessage() {}
+
+// GetResults returns the matching modules and sources
+func (m *SearchResponse) GetResults() []*SearchResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+// SearchServiceClient finds modules and sources without knowing their exact names.
+type SearchServiceClient interface {
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+}
+
+// NewSearchServiceClient constructs a SearchServiceClient using the connection
+func NewSearchServiceClient(cc *grpc.ClientConn) SearchServiceClient {
+	return &searchServiceClient{cc: cc}
+}
+
+type searchServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *searchServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := &SearchResponse{}
+	if err := c.cc.Invoke(ctx, "/"+searchServiceName+"/Search", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type searchServiceServer interface {
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+}
+
+var searchServiceDesc = grpc.ServiceDesc{
+	ServiceName: searchServiceName,
+	HandlerType: (*searchServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &SearchRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(searchServiceServer).Search(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + searchServiceName + "/Search"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(searchServiceServer).Search(ctx, req.(*SearchRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// RegisterSearchService registers the searchService implementation with the server
+func RegisterSearchService(server *grpc.Server, gs store.GraphStoreClient) {
+	server.RegisterService(&searchServiceDesc, &searchService{gs: gs})
+}
+
+type searchService struct {
+	gs store.GraphStoreClient
+}
+
+var _ searchServiceServer = &searchService{}
+
+func (s *searchService) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	searcher, ok := s.gs.(graphstore.Searcher)
+	if !ok {
+		return nil, api.ErrUnimplemented
+	}
+
+	searchTypes := []string{types.ModuleType, types.SourceType}
+	switch req.Type {
+	case "":
+	case types.ModuleType, types.SourceType:
+		searchTypes = []string{req.Type}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid type: %s", req.Type)
+	}
+
+	resp, err := searcher.Search(ctx, &graphstore.SearchRequest{
+		Query:          req.Query,
+		Types:          searchTypes,
+		DependentTypes: []string{types.DependsType},
+		Count:          req.Count,
+	})
+	if err != nil {
+		logrus.Errorf("[service.search] %s", err.Error())
+		return nil, err
+	}
+
+	results := make([]*SearchResult, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		decoded, err := Decode(result.Item)
+		if err != nil {
+			logrus.Errorf("[service.search] %s", err.Error())
+			return nil, err
+		}
+
+		searchResult := &SearchResult{Dependents: result.Dependents, Score: result.Score}
+		switch item := decoded.(type) {
+		case *schema.Module:
+			searchResult.Module = item
+		case *schema.Source:
+			searchResult.Source = item
+		}
+
+		results = append(results, searchResult)
+	}
+
+	return &SearchResponse{Results: results}, nil
+}
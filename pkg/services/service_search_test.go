@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSearchService(t *testing.T) {
+	gs := newTestGraphStoreClient(t, "TestSearchService")
+	trackDiamond(t, gs)
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer()
+	RegisterSearchService(server, gs)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	client := NewSearchServiceClient(conn)
+
+	modules, err := client.Search(context.Background(), &SearchRequest{Query: "deps-cloud", Type: "module"})
+	require.Nil(t, err)
+	require.Len(t, modules.GetResults(), 4)
+	require.Equal(t, "d", modules.GetResults()[0].GetModule().GetModule())
+	require.Equal(t, int64(2), modules.GetResults()[0].Dependents)
+	require.Equal(t, "a", modules.GetResults()[3].GetModule().GetModule())
+
+	// typos are tolerated
+	sources, err := client.Search(context.Background(), &SearchRequest{Query: "exampel", Type: "source"})
+	require.Nil(t, err)
+	require.Len(t, sources.GetResults(), 3)
+	for _, result := range sources.GetResults() {
+		require.NotNil(t, result.GetSource())
+	}
+
+	_, err = client.Search(context.Background(), &SearchRequest{Query: "deps", Type: "depends"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/deps-cloud/api"
 	"github.com/deps-cloud/api/v1alpha/schema"
 	"github.com/deps-cloud/api/v1alpha/store"
 	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
 	"github.com/deps-cloud/tracker/pkg/types"
 
 	"github.com/sirupsen/logrus"
@@ -26,31 +28,35 @@ type sourceService struct {
 var _ tracker.SourceServiceServer = &sourceService{}
 
 func (s *sourceService) List(ctx context.Context, req *tracker.ListRequest) (*tracker.ListSourceResponse, error) {
-	resp, err := s.gs.List(ctx, &store.ListRequest{
-		Page:  req.GetPage(),
-		Count: req.GetCount(),
-		Type:  types.SourceType,
-	})
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	items, count, err := listItems(ctx, s.gs, types.SourceType, req, sourceFilters)
 	if err != nil {
 		logrus.Errorf("[service.source] %s", err.Error())
 		return nil, err
 	}
 
-	sources := make([]*schema.Source, 0, len(resp.GetItems()))
-	for _, item := range resp.GetItems() {
+	sources := make([]*schema.Source, 0, len(items))
+	for _, item := range items {
 		source, _ := Decode(item)
 		sources = append(sources, source.(*schema.Source))
 	}
 
 	return &tracker.ListSourceResponse{
 		Page:    req.GetPage(),
-		Count:   req.GetCount(),
+		Count:   count,
 		Sources: sources,
 	}, nil
 }
 
 func (s *sourceService) Track(ctx context.Context, req *tracker.SourceRequest) (*tracker.TrackResponse, error) {
+	if err := rejectAsOf(ctx); err != nil {
+		return nil, err
+	}
+
 	currentSet, err := s.getCurrent(ctx, req.GetSource())
 	if err != nil {
 		logrus.Errorf("[service.source] %s", err.Error())
@@ -75,20 +81,63 @@ func (s *sourceService) Track(ctx context.Context, req *tracker.SourceRequest) (
 		toPut = append(toPut, item)
 	}
 
+	revision, err := newRevision(req.GetSource(), currentSet, proposedSet, time.Now())
+	if err != nil {
+		logrus.Errorf("[service.source] %s", err.Error())
+		return nil, err
+	}
+
+	// the revision is written alongside the changes it records, replacing the
+	// oldest revisions once the source has too many
+	if len(revision) > 0 {
+		expired, err := expiredRevisions(ctx, s.gs, req.GetSource())
+		if err != nil {
+			logrus.Errorf("[service.source] %s", err.Error())
+			return nil, err
+		}
+
+		toDelete = append(toDelete, expired...)
+		toPut = append(toPut, revision...)
+	}
+
 	logrus.Infof("[service.source] currentSet=%d proposedSet=%d toDelete=%d toPut=%d",
 		len(currentSet), len(proposedSet), len(toDelete), len(toPut))
 
+	if err := s.apply(ctx, toDelete, toPut); err != nil {
+		return nil, err
+	}
+
+	return &tracker.TrackResponse{Tracking: true}, nil
+}
+
+// apply removes the stale items and writes the proposed ones atomically when
+// the graph store supports it, falling back to a delete followed by a put.
+func (s *sourceService) apply(ctx context.Context, toDelete, toPut []*store.GraphItem) error {
+	if applier, ok := s.gs.(graphstore.Applier); ok {
+		_, err := applier.Apply(ctx, &graphstore.ApplyRequest{
+			Deletes: toDelete,
+			Puts:    toPut,
+		})
+
+		if err == nil {
+			return nil
+		} else if err != api.ErrUnimplemented {
+			logrus.Errorf("[service.source] %s", err.Error())
+			return err
+		}
+	}
+
 	if _, err := s.gs.Delete(ctx, &store.DeleteRequest{Items: toDelete}); err != nil {
 		logrus.Errorf("[service.source] %s", err.Error())
-		return nil, api.ErrPartialDeletion
+		return api.ErrPartialDeletion
 	}
 
 	if _, err := s.gs.Put(ctx, &store.PutRequest{Items: toPut}); err != nil {
 		logrus.Errorf("[service.source] %s", err.Error())
-		return nil, api.ErrPartialInsertion
+		return api.ErrPartialInsertion
 	}
 
-	return &tracker.TrackResponse{Tracking: true}, nil
+	return nil
 }
 
 func (s *sourceService) getCurrent(ctx context.Context, source *schema.Source) (map[string]*store.GraphItem, error) {
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deps-cloud/api/v1alpha/deps"
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTrack(t *testing.T) {
+	for name, gs := range map[string]store.GraphStoreClient{
+		"apply": newTestGraphStoreClient(t, "TestTrack"),
+		// the api client does not support applying changes atomically
+		"fallback": store.NewInProcessGraphStoreClient(graphstore.NewMemoryGraphStore()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			sources := &sourceService{gs: gs}
+			topology := &topologyService{gs: gs}
+
+			track := func(file *deps.DependencyManagementFile) {
+				_, err := sources.Track(context.Background(), &tracker.SourceRequest{
+					Source:          &schema.Source{Url: "https://example.com/a.git"},
+					ManagementFiles: []*deps.DependencyManagementFile{file},
+				})
+				require.Nil(t, err)
+			}
+
+			track(managementFile("a", "b", "c"))
+
+			resp, err := topology.ListDependenciesTopology(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"b", "c"}, moduleNames(resp.GetDependencies()))
+
+			// tracking again replaces the stale dependencies
+			track(managementFile("a", "c", "d"))
+
+			resp, err = topology.ListDependenciesTopology(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"c", "d"}, moduleNames(resp.GetDependencies()))
+		})
+	}
+}
+
+func TestTrack_asOf(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestTrack_asOf") {
+		t.Run(backend, func(t *testing.T) {
+			sources := &sourceService{gs: gs}
+			dependencies := &dependencyService{gs: gs}
+
+			track := func(ctx context.Context, file *deps.DependencyManagementFile) error {
+				_, err := sources.Track(ctx, &tracker.SourceRequest{
+					Source:          &schema.Source{Url: "https://example.com/a.git"},
+					ManagementFiles: []*deps.DependencyManagementFile{file},
+				})
+				return err
+			}
+
+			require.Nil(t, track(context.Background(), managementFile("a", "b", "c")))
+
+			time.Sleep(10 * time.Millisecond)
+			before := time.Now()
+			time.Sleep(10 * time.Millisecond)
+
+			require.Nil(t, track(context.Background(), managementFile("a", "c", "d")))
+
+			asOf := func(value string) context.Context {
+				return metadata.NewIncomingContext(context.Background(), metadata.Pairs(asOfHeader, value))
+			}
+
+			// reads honour the header
+			resp, err := dependencies.ListDependencies(asOf(before.Format(time.RFC3339Nano)), dependencyRequest("a"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"b", "c"}, moduleNames(resp.GetDependencies()))
+
+			_, err = dependencies.ListDependencies(asOf("yesterday"), dependencyRequest("a"))
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			// writes must be computed from the current graph
+			err = track(asOf(before.Format(time.RFC3339Nano)), managementFile("a", "b"))
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			resp, err = dependencies.ListDependencies(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"c", "d"}, moduleNames(resp.GetDependencies()))
+		})
+	}
+}
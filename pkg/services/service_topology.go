@@ -2,12 +2,34 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/deps-cloud/api"
 	"github.com/deps-cloud/api/v1alpha/store"
 	"github.com/deps-cloud/api/v1alpha/tracker"
 
+	"github.com/sirupsen/logrus"
+
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// cycleHeader is the response header used to report the members of each
+	// cycle encountered while computing a topology. Each value describes one cycle.
+	cycleHeader = "x-dependency-cycle"
+	// maxDepthHeader is the request header used to limit the number of edges
+	// followed while computing a topology.
+	maxDepthHeader = "x-topology-max-depth"
+	// maxTopologyDepth is the largest depth accepted using the maxDepthHeader
+	maxTopologyDepth = 100
+	// scopeHeader is the request header used to restrict the depends edges
+	// followed while computing a topology. It may be provided multiple times.
+	scopeHeader = "x-topology-scope"
 )
 
 // RegisterTopologyService registers the topologyService implementation with the server
@@ -21,18 +43,142 @@ type topologyService struct {
 
 var _ tracker.TopologyServiceServer = &topologyService{}
 
+func topologyTiers(tiers [][]*tracker.Dependency) []*tracker.TopologyTier {
+	results := make([]*tracker.TopologyTier, len(tiers))
+	for i, tier := range tiers {
+		results[i] = &tracker.TopologyTier{Tier: tier}
+	}
+	return results
+}
+
+// reportCycles logs each cycle in the graph and returns them to the caller
+// using the cycleHeader.
+func reportCycles(ctx context.Context, graph *topology) {
+	cycles := graph.cycles()
+	if len(cycles) == 0 {
+		return
+	}
+
+	values := make([]string, len(cycles))
+	for i, cycle := range cycles {
+		members := make([]string, len(cycle))
+		for j, module := range cycle {
+			members[j] = fmt.Sprintf("%s/%s/%s", module.GetLanguage(), module.GetOrganization(), module.GetModule())
+		}
+		values[i] = strings.Join(members, ",")
+
+		logrus.Warnf("[service.topology] detected cycle: %s", values[i])
+	}
+
+	header := metadata.MD{}
+	header.Append(cycleHeader, values...)
+
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		logrus.Debugf("[service.topology] failed to report cycles: %s", err.Error())
+	}
+}
+
+// topologyError reports a failed traversal as a missing module, unless the
+// request was interrupted or the graph store failed for another reason that
+// the caller should see.
+func topologyError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	if code := status.Code(err); code != codes.Unknown && code != codes.NotFound {
+		return err
+	}
+
+	return api.ErrModuleNotFound
+}
+
+// traversalFromContext reads the traversal limits provided in the request headers.
+func traversalFromContext(ctx context.Context) (traversal, error) {
+	options := traversal{}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return options, nil
+	}
+
+	if values := md.Get(maxDepthHeader); len(values) > 0 {
+		maxDepth, err := strconv.Atoi(values[0])
+		if err != nil || maxDepth < 0 || maxDepth > maxTopologyDepth {
+			return options, status.Errorf(codes.InvalidArgument, "invalid %s: %s", maxDepthHeader, values[0])
+		}
+		options.maxDepth = maxDepth
+	}
+
+	options.scopes = md.Get(scopeHeader)
+
+	return options, nil
+}
+
+func (t *topologyService) topology(ctx context.Context, req *tracker.DependencyRequest, downstream bool) (*topology, error) {
+	ctx, err := asOfFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := traversalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := traverse(ctx, t.gs, moduleForDependencyRequest(req), downstream, options)
+	if err != nil {
+		logrus.Errorf("[service.topology] %s", err.Error())
+		return nil, topologyError(ctx, err)
+	}
+
+	reportCycles(ctx, graph)
+	return graph, nil
+}
+
 func (t *topologyService) ListDependentsTopology(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependentsResponse, error) {
-	return nil, api.ErrUnimplemented
+	graph, err := t.topology(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracker.ListDependentsResponse{
+		Dependents: graph.sorted(),
+	}, nil
 }
 
 func (t *topologyService) ListDependentsTopologyTiered(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependentsTieredResponse, error) {
-	return nil, api.ErrUnimplemented
+	graph, err := t.topology(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracker.ListDependentsTieredResponse{
+		Tiers: topologyTiers(graph.tiered()),
+	}, nil
 }
 
 func (t *topologyService) ListDependenciesTopology(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependenciesResponse, error) {
-	return nil, api.ErrUnimplemented
+	graph, err := t.topology(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracker.ListDependenciesResponse{
+		Dependencies: graph.sorted(),
+	}, nil
 }
 
 func (t *topologyService) ListDependenciesTopologyTiered(ctx context.Context, req *tracker.DependencyRequest) (*tracker.ListDependenciesTieredResponse, error) {
-	return nil, api.ErrUnimplemented
+	graph, err := t.topology(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracker.ListDependenciesTieredResponse{
+		Tiers: topologyTiers(graph.tiered()),
+	}, nil
 }
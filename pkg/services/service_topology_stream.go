@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/sirupsen/logrus"
+
+	"google.golang.org/grpc"
+)
+
+// The TopologyStreamService is not yet part of the published api. Until it is,
+// the service is described by hand using the existing tracker messages.
+const topologyStreamServiceName = "cloud.deps.api.v1alpha.tracker.TopologyStreamService"
+
+// TopologyTierReceiver receives the tiers of a streamed topology. Streamed tiers
+// group modules by their shortest distance from the requested module, which
+// differs from the tiers of ListDependentsTopologyTiered and
+// ListDependenciesTopologyTiered. Those place every module after all of the
+// modules it requires, which cannot be known until the traversal completes, so
+// a module may be streamed in an earlier tier than it is layered in. Recv
+// returns io.EOF once the traversal completes.
+type TopologyTierReceiver interface {
+	Recv() (*tracker.TopologyTier, error)
+	grpc.ClientStream
+}
+
+// TopologyStreamServiceClient streams topologies tier by tier as the tracker
+// discovers them.
+type TopologyStreamServiceClient interface {
+	ListDependentsTopologyStream(ctx context.Context, in *tracker.DependencyRequest, opts ...grpc.CallOption) (TopologyTierReceiver, error)
+	ListDependenciesTopologyStream(ctx context.Context, in *tracker.DependencyRequest, opts ...grpc.CallOption) (TopologyTierReceiver, error)
+}
+
+// NewTopologyStreamServiceClient constructs a TopologyStreamServiceClient using the connection
+func NewTopologyStreamServiceClient(cc *grpc.ClientConn) TopologyStreamServiceClient {
+	return &topologyStreamServiceClient{cc: cc}
+}
+
+type topologyStreamServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *topologyStreamServiceClient) stream(ctx context.Context, method string, in *tracker.DependencyRequest, opts ...grpc.CallOption) (TopologyTierReceiver, error) {
+	stream, err := c.cc.NewStream(ctx, &topologyStreamServiceDesc.Streams[0], "/"+topologyStreamServiceName+"/"+method, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stream.SendMsg(in); err != nil {
+		return nil, err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	return &topologyTierReceiver{stream}, nil
+}
+
+func (c *topologyStreamServiceClient) ListDependentsTopologyStream(ctx context.Context, in *tracker.DependencyRequest, opts ...grpc.CallOption) (TopologyTierReceiver, error) {
+	return c.stream(ctx, "ListDependentsTopologyStream", in, opts...)
+}
+
+func (c *topologyStreamServiceClient) ListDependenciesTopologyStream(ctx context.Context, in *tracker.DependencyRequest, opts ...grpc.CallOption) (TopologyTierReceiver, error) {
+	return c.stream(ctx, "ListDependenciesTopologyStream", in, opts...)
+}
+
+type topologyTierReceiver struct {
+	grpc.ClientStream
+}
+
+func (r *topologyTierReceiver) Recv() (*tracker.TopologyTier, error) {
+	m := &tracker.TopologyTier{}
+	if err := r.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type topologyTierSender interface {
+	Send(*tracker.TopologyTier) error
+	grpc.ServerStream
+}
+
+type topologyTierStream struct {
+	grpc.ServerStream
+}
+
+func (s *topologyTierStream) Send(m *tracker.TopologyTier) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+type topologyStreamServiceServer interface {
+	ListDependentsTopologyStream(*tracker.DependencyRequest, topologyTierSender) error
+	ListDependenciesTopologyStream(*tracker.DependencyRequest, topologyTierSender) error
+}
+
+func topologyStreamHandler(call func(topologyStreamServiceServer, *tracker.DependencyRequest, topologyTierSender) error) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		m := &tracker.DependencyRequest{}
+		if err := stream.RecvMsg(m); err != nil {
+			return err
+		}
+		return call(srv.(topologyStreamServiceServer), m, &topologyTierStream{stream})
+	}
+}
+
+var topologyStreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: topologyStreamServiceName,
+	HandlerType: (*topologyStreamServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ListDependentsTopologyStream",
+			Handler: topologyStreamHandler(func(srv topologyStreamServiceServer, req *tracker.DependencyRequest, stream topologyTierSender) error {
+				return srv.ListDependentsTopologyStream(req, stream)
+			}),
+			ServerStreams: true,
+		},
+		{
+			StreamName: "ListDependenciesTopologyStream",
+			Handler: topologyStreamHandler(func(srv topologyStreamServiceServer, req *tracker.DependencyRequest, stream topologyTierSender) error {
+				return srv.ListDependenciesTopologyStream(req, stream)
+			}),
+			ServerStreams: true,
+		},
+	},
+}
+
+// RegisterTopologyStreamService registers the topologyStreamService implementation with the server
+func RegisterTopologyStreamService(server *grpc.Server, gs store.GraphStoreClient) {
+	server.RegisterService(&topologyStreamServiceDesc, &topologyStreamService{gs: gs})
+}
+
+type topologyStreamService struct {
+	gs store.GraphStoreClient
+}
+
+var _ topologyStreamServiceServer = &topologyStreamService{}
+
+// streamByDistance walks the graph breadth first, sending the modules first
+// reached at each distance as a tier. Only the set of visited modules is
+// retained between tiers.
+func (t *topologyStreamService) streamByDistance(req *tracker.DependencyRequest, stream topologyTierSender, downstream bool) error {
+	ctx, err := asOfFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	options, err := traversalFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	find := t.gs.FindUpstream
+	if downstream {
+		find = t.gs.FindDownstream
+	}
+
+	key := keyForDependencyRequest(req)
+	sent := map[string]bool{moduleReadableKey(key): true}
+
+	err = walk(ctx, find, key, options, func(pairs []*graphstore.TraversedPair) error {
+		frontier := make([]*tracker.Dependency, 0)
+
+		for _, pair := range pairs {
+			node := readableKey(pair.Node)
+			if sent[node] {
+				continue
+			}
+			sent[node] = true
+
+			a, err := Decode(pair.Node)
+			if err != nil {
+				return err
+			}
+
+			b, err := Decode(pair.Edge)
+			if err != nil {
+				return err
+			}
+
+			frontier = append(frontier, &tracker.Dependency{
+				Module:  a.(*schema.Module),
+				Depends: b.(*schema.Depends),
+			})
+		}
+
+		if len(frontier) == 0 {
+			return nil
+		}
+
+		return stream.Send(&tracker.TopologyTier{Tier: frontier})
+	})
+
+	if err != nil {
+		logrus.Errorf("[service.topology] %s", err.Error())
+		return topologyError(ctx, err)
+	}
+
+	return nil
+}
+
+func (t *topologyStreamService) ListDependentsTopologyStream(req *tracker.DependencyRequest, stream topologyTierSender) error {
+	return t.streamByDistance(req, stream, true)
+}
+
+func (t *topologyStreamService) ListDependenciesTopologyStream(req *tracker.DependencyRequest, stream topologyTierSender) error {
+	return t.streamByDistance(req, stream, false)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTopologyStreamService(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestTopologyStreamService") {
+		t.Run(backend, func(t *testing.T) {
+			trackDiamond(t, gs)
+
+			listener := bufconn.Listen(1024 * 1024)
+
+			server := grpc.NewServer()
+			RegisterTopologyStreamService(server, gs)
+			go server.Serve(listener)
+			defer server.Stop()
+
+			conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+				return listener.Dial()
+			}))
+			require.Nil(t, err)
+			defer conn.Close()
+
+			client := NewTopologyStreamServiceClient(conn)
+
+			receive := func(receiver TopologyTierReceiver) [][]string {
+				tiers := make([][]string, 0)
+				for {
+					tier, err := receiver.Recv()
+					if err == io.EOF {
+						return tiers
+					}
+					require.Nil(t, err)
+					tiers = append(tiers, moduleNames(tier.GetTier()))
+				}
+			}
+
+			dependents, err := client.ListDependentsTopologyStream(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+
+			tiers := receive(dependents)
+			require.Len(t, tiers, 2)
+			require.ElementsMatch(t, []string{"b", "c"}, tiers[0])
+			require.Equal(t, []string{"a"}, tiers[1])
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), maxDepthHeader, "1")
+			dependencies, err := client.ListDependenciesTopologyStream(ctx, dependencyRequest("a"))
+			require.Nil(t, err)
+
+			tiers = receive(dependencies)
+			require.Len(t, tiers, 1)
+			require.ElementsMatch(t, []string{"b", "c"}, tiers[0])
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/deps"
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestGraphStore(t *testing.T, name string) store.GraphStoreServer {
+	db, err := sqlx.Open("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+	require.Nil(t, err)
+
+	graphStore, err := graphstore.NewSQLGraphStore(db, db, graphstore.DefaultStatements())
+	require.Nil(t, err)
+
+	return graphStore
+}
+
+func newTestGraphStoreClient(t *testing.T, name string) store.GraphStoreClient {
+	return graphstore.NewInProcessGraphStoreClient(newTestGraphStore(t, name))
+}
+
+// newTestGraphStoreClients returns a client for each graph store backend so
+// that both the SQL traversals and the in memory walks are exercised.
+func newTestGraphStoreClients(t *testing.T, name string) map[string]store.GraphStoreClient {
+	return map[string]store.GraphStoreClient{
+		"sqlite": newTestGraphStoreClient(t, name),
+		"memory": graphstore.NewInProcessGraphStoreClient(graphstore.NewMemoryGraphStore()),
+	}
+}
+
+func managementFile(module string, dependencies ...string) *deps.DependencyManagementFile {
+	language := "go"
+	organization := "deps-cloud"
+
+	dependencyList := make([]*deps.Dependency, len(dependencies))
+	for i := range dependencies {
+		dependencyList[i] = &deps.Dependency{
+			Organization: &organization,
+			Module:       &dependencies[i],
+		}
+	}
+
+	return &deps.DependencyManagementFile{
+		Language:     &language,
+		Organization: &organization,
+		Module:       &module,
+		Dependencies: dependencyList,
+	}
+}
+
+// trackDiamond tracks the following graph where edges point at dependencies
+//
+//	a -> b -> d
+//	a -> c -> d
+func trackDiamond(t *testing.T, gs store.GraphStoreClient) {
+	sources := &sourceService{gs: gs}
+
+	for url, file := range map[string]*deps.DependencyManagementFile{
+		"https://example.com/a.git": managementFile("a", "b", "c"),
+		"https://example.com/b.git": managementFile("b", "d"),
+		"https://example.com/c.git": managementFile("c", "d"),
+	} {
+		_, err := sources.Track(context.Background(), &tracker.SourceRequest{
+			Source:          &schema.Source{Url: url},
+			ManagementFiles: []*deps.DependencyManagementFile{file},
+		})
+		require.Nil(t, err)
+	}
+}
+
+func dependencyRequest(module string) *tracker.DependencyRequest {
+	return &tracker.DependencyRequest{
+		Language:     "go",
+		Organization: "deps-cloud",
+		Module:       module,
+	}
+}
+
+func moduleNames(dependencies []*tracker.Dependency) []string {
+	names := make([]string, len(dependencies))
+	for i, dependency := range dependencies {
+		names[i] = dependency.GetModule().GetModule()
+	}
+	return names
+}
+
+func TestListDependentsTopology(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestListDependentsTopology") {
+		t.Run(backend, func(t *testing.T) {
+			trackDiamond(t, gs)
+
+			topology := &topologyService{gs: gs}
+
+			resp, err := topology.ListDependentsTopology(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+
+			names := moduleNames(resp.GetDependents())
+			require.Len(t, names, 3)
+			require.ElementsMatch(t, []string{"b", "c"}, names[:2])
+			require.Equal(t, "a", names[2])
+
+			resp, err = topology.ListDependentsTopology(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+			require.Len(t, resp.GetDependents(), 0)
+		})
+	}
+}
+
+func TestListDependentsTopology_breadthFirst(t *testing.T) {
+	// the api client does not support server side traversals
+	gs := store.NewInProcessGraphStoreClient(newTestGraphStore(t, "TestListDependentsTopology_breadthFirst"))
+	trackDiamond(t, gs)
+
+	topology := &topologyService{gs: gs}
+
+	resp, err := topology.ListDependentsTopology(context.Background(), dependencyRequest("d"))
+	require.Nil(t, err)
+
+	names := moduleNames(resp.GetDependents())
+	require.Len(t, names, 3)
+	require.ElementsMatch(t, []string{"b", "c"}, names[:2])
+	require.Equal(t, "a", names[2])
+}
+
+func TestListDependenciesTopology(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestListDependenciesTopology") {
+		t.Run(backend, func(t *testing.T) {
+			trackDiamond(t, gs)
+
+			topology := &topologyService{gs: gs}
+
+			resp, err := topology.ListDependenciesTopology(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+
+			names := moduleNames(resp.GetDependencies())
+			require.Len(t, names, 3)
+			require.Equal(t, "d", names[0])
+			require.ElementsMatch(t, []string{"b", "c"}, names[1:])
+
+			resp, err = topology.ListDependenciesTopology(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+			require.Len(t, resp.GetDependencies(), 0)
+		})
+	}
+}
+
+func tierNames(tiers []*tracker.TopologyTier) [][]string {
+	names := make([][]string, len(tiers))
+	for i, tier := range tiers {
+		names[i] = moduleNames(tier.GetTier())
+	}
+	return names
+}
+
+func TestListTopologyTiered(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestListTopologyTiered") {
+		t.Run(backend, func(t *testing.T) {
+			trackDiamond(t, gs)
+
+			topology := &topologyService{gs: gs}
+
+			dependents, err := topology.ListDependentsTopologyTiered(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+
+			names := tierNames(dependents.GetTiers())
+			require.Len(t, names, 2)
+			require.ElementsMatch(t, []string{"b", "c"}, names[0])
+			require.Equal(t, []string{"a"}, names[1])
+
+			dependencies, err := topology.ListDependenciesTopologyTiered(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+
+			names = tierNames(dependencies.GetTiers())
+			require.Len(t, names, 2)
+			require.Equal(t, []string{"d"}, names[0])
+			require.ElementsMatch(t, []string{"b", "c"}, names[1])
+		})
+	}
+}
+
+func TestTopologyCycles(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestTopologyCycles") {
+		t.Run(backend, func(t *testing.T) {
+			sources := &sourceService{gs: gs}
+
+			// a -> b -> c -> b, c -> d
+			for url, file := range map[string]*deps.DependencyManagementFile{
+				"https://example.com/a.git": managementFile("a", "b"),
+				"https://example.com/b.git": managementFile("b", "c"),
+				"https://example.com/c.git": managementFile("c", "b", "d"),
+			} {
+				_, err := sources.Track(context.Background(), &tracker.SourceRequest{
+					Source:          &schema.Source{Url: url},
+					ManagementFiles: []*deps.DependencyManagementFile{file},
+				})
+				require.Nil(t, err)
+			}
+
+			topology := &topologyService{gs: gs}
+
+			dependencies, err := topology.ListDependenciesTopologyTiered(context.Background(), dependencyRequest("a"))
+			require.Nil(t, err)
+
+			names := tierNames(dependencies.GetTiers())
+			require.Len(t, names, 2)
+			require.Equal(t, []string{"d"}, names[0])
+			require.ElementsMatch(t, []string{"b", "c"}, names[1])
+
+			dependents, err := topology.ListDependentsTopology(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+
+			flat := moduleNames(dependents.GetDependents())
+			require.Len(t, flat, 3)
+			require.ElementsMatch(t, []string{"b", "c"}, flat[:2])
+			require.Equal(t, "a", flat[2])
+
+			graph, err := traverse(context.Background(), gs, moduleForDependencyRequest(dependencyRequest("b")), false, traversal{})
+			require.Nil(t, err)
+
+			cycles := graph.cycles()
+			require.Len(t, cycles, 1)
+			require.ElementsMatch(t, []string{"b", "c"}, []string{cycles[0][0].GetModule(), cycles[0][1].GetModule()})
+		})
+	}
+}
+
+func TestTopologyTraversalLimits(t *testing.T) {
+	for backend, gs := range newTestGraphStoreClients(t, "TestTopologyTraversalLimits") {
+		t.Run(backend, func(t *testing.T) {
+			trackDiamond(t, gs)
+
+			language := "go"
+			organization := "deps-cloud"
+			module := "e"
+			dependency := "a"
+
+			// e depends on a only for tests
+			_, err := (&sourceService{gs: gs}).Track(context.Background(), &tracker.SourceRequest{
+				Source: &schema.Source{Url: "https://example.com/e.git"},
+				ManagementFiles: []*deps.DependencyManagementFile{
+					{
+						Language:     &language,
+						Organization: &organization,
+						Module:       &module,
+						Dependencies: []*deps.Dependency{
+							{Organization: &organization, Module: &dependency, Scopes: []string{"test"}},
+						},
+					},
+				},
+			})
+			require.Nil(t, err)
+
+			topology := &topologyService{gs: gs}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(maxDepthHeader, "1"))
+			resp, err := topology.ListDependentsTopology(ctx, dependencyRequest("d"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"b", "c"}, moduleNames(resp.GetDependents()))
+
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(maxDepthHeader, "2"))
+			resp, err = topology.ListDependentsTopology(ctx, dependencyRequest("d"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"a", "b", "c"}, moduleNames(resp.GetDependents()))
+
+			resp, err = topology.ListDependentsTopology(context.Background(), dependencyRequest("d"))
+			require.Nil(t, err)
+			require.ElementsMatch(t, []string{"a", "b", "c", "e"}, moduleNames(resp.GetDependents()))
+
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(scopeHeader, "test"))
+			resp, err = topology.ListDependentsTopology(ctx, dependencyRequest("a"))
+			require.Nil(t, err)
+			require.Equal(t, []string{"e"}, moduleNames(resp.GetDependents()))
+
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(scopeHeader, "compile"))
+			resp, err = topology.ListDependentsTopology(ctx, dependencyRequest("a"))
+			require.Nil(t, err)
+			require.Len(t, resp.GetDependents(), 0)
+
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(maxDepthHeader, "many"))
+			_, err = topology.ListDependentsTopology(ctx, dependencyRequest("d"))
+			require.NotNil(t, err)
+
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(maxDepthHeader, "101"))
+			_, err = topology.ListDependentsTopology(ctx, dependencyRequest("d"))
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestTopologyError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.Equal(t, codes.Canceled, status.Code(topologyError(cancelled, cancelled.Err())))
+	require.Equal(t, codes.Unavailable, status.Code(topologyError(context.Background(), status.Error(codes.Unavailable, "down"))))
+	require.Equal(t, api.ErrModuleNotFound, topologyError(context.Background(), fmt.Errorf("missing")))
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+
+	"github.com/deps-cloud/api"
+	"github.com/deps-cloud/api/v1alpha/schema"
+	"github.com/deps-cloud/api/v1alpha/store"
+	"github.com/deps-cloud/api/v1alpha/tracker"
+	"github.com/deps-cloud/tracker/pkg/services/graphstore"
+	"github.com/deps-cloud/tracker/pkg/types"
+
+	"google.golang.org/grpc"
+)
+
+type findFunc func(ctx context.Context, in *store.FindRequest, opts ...grpc.CallOption) (*store.FindResponse, error)
+
+// topology is the transitive closure of a module collected during a traversal.
+// Each node is recorded alongside the edge it was first discovered through.
+type topology struct {
+	root       string
+	rootModule *schema.Module
+	// order contains node keys in the order they were discovered
+	order []string
+	nodes map[string]*tracker.Dependency
+	// requires maps a node key to the set of node keys that must precede it
+	requires map[string]map[string]bool
+}
+
+func newTopology(root string, rootModule *schema.Module) *topology {
+	return &topology{
+		root:       root,
+		rootModule: rootModule,
+		order:      make([]string, 0),
+		nodes:      make(map[string]*tracker.Dependency),
+		requires:   make(map[string]map[string]bool),
+	}
+}
+
+func (t *topology) require(key, prerequisite string) {
+	if _, ok := t.requires[key]; !ok {
+		t.requires[key] = make(map[string]bool)
+	}
+	t.requires[key][prerequisite] = true
+}
+
+// components returns the strongly connected components of the topology, root
+// included, using Tarjan's algorithm. Since an edge points from a node to its
+// prerequisite, components are produced after all of their prerequisites.
+func (t *topology) components() [][]string {
+	index := 0
+	indices := make(map[string]int)
+	lowlinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	components := make([][]string, 0)
+
+	var connect func(key string)
+	connect = func(key string) {
+		indices[key] = index
+		lowlinks[key] = index
+		index++
+
+		stack = append(stack, key)
+		onStack[key] = true
+
+		for prerequisite := range t.requires[key] {
+			if _, ok := indices[prerequisite]; !ok {
+				connect(prerequisite)
+				if lowlinks[prerequisite] < lowlinks[key] {
+					lowlinks[key] = lowlinks[prerequisite]
+				}
+			} else if onStack[prerequisite] && indices[prerequisite] < lowlinks[key] {
+				lowlinks[key] = indices[prerequisite]
+			}
+		}
+
+		if lowlinks[key] == indices[key] {
+			component := make([]string, 0)
+			for {
+				member := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[member] = false
+				component = append(component, member)
+
+				if member == key {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	connect(t.root)
+	for _, key := range t.order {
+		if _, ok := indices[key]; !ok {
+			connect(key)
+		}
+	}
+
+	return components
+}
+
+// cycles returns the modules participating in each cycle of the topology.
+func (t *topology) cycles() [][]*schema.Module {
+	cycles := make([][]*schema.Module, 0)
+
+	for _, component := range t.components() {
+		if len(component) < 2 {
+			continue
+		}
+
+		modules := make([]*schema.Module, len(component))
+		for i, key := range component {
+			if key == t.root {
+				modules[i] = t.rootModule
+			} else {
+				modules[i] = t.nodes[key].GetModule()
+			}
+		}
+
+		cycles = append(cycles, modules)
+	}
+
+	return cycles
+}
+
+// tiered groups the nodes in the topology such that every node in a tier only
+// requires nodes from earlier tiers. Members of a cycle are collapsed into the
+// same tier. Requirements on the root of the traversal are considered satisfied
+// unless the root is part of a cycle.
+func (t *topology) tiered() [][]*tracker.Dependency {
+	levels := make(map[string]int, len(t.order))
+	depth := 0
+
+	for _, component := range t.components() {
+		if len(component) == 1 && component[0] == t.root {
+			continue
+		}
+
+		members := make(map[string]bool, len(component))
+		for _, key := range component {
+			members[key] = true
+		}
+
+		level := 0
+		for _, key := range component {
+			for prerequisite := range t.requires[key] {
+				if prerequisiteLevel, ok := levels[prerequisite]; ok && !members[prerequisite] && prerequisiteLevel >= level {
+					level = prerequisiteLevel + 1
+				}
+			}
+		}
+
+		for _, key := range component {
+			levels[key] = level
+		}
+
+		if level >= depth {
+			depth = level + 1
+		}
+	}
+
+	tiers := make([][]*tracker.Dependency, depth)
+	for _, key := range t.order {
+		level := levels[key]
+		tiers[level] = append(tiers[level], t.nodes[key])
+	}
+
+	return tiers
+}
+
+// sorted returns the nodes in the topology such that every node appears after
+// the nodes it requires.
+func (t *topology) sorted() []*tracker.Dependency {
+	results := make([]*tracker.Dependency, 0, len(t.order))
+	for _, tier := range t.tiered() {
+		results = append(results, tier...)
+	}
+	return results
+}
+
+// moduleReadableKey returns the readableKey of the module node with the given key.
+func moduleReadableKey(key []byte) string {
+	return readableKey(&store.GraphItem{
+		GraphItemType: types.ModuleType,
+		K1:            key,
+		K2:            key,
+	})
+}
+
+// traversal limits the portion of the graph visited while collecting a topology.
+type traversal struct {
+	// maxDepth is the number of edges that can be followed, zero for no limit
+	maxDepth int
+	// scopes limits the depends edges that are followed, empty for all
+	scopes []string
+}
+
+// follows returns whether the traversal should follow the provided depends edge.
+func (t traversal) follows(edge *store.GraphItem) (bool, error) {
+	if len(t.scopes) == 0 {
+		return true, nil
+	}
+
+	item, err := Decode(edge)
+	if err != nil {
+		return false, err
+	}
+
+	for _, scope := range item.(*schema.Depends).GetScopes() {
+		for _, wanted := range t.scopes {
+			if scope == wanted {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// walk visits the graph one node at a time using find, passing the pairs found
+// at each depth to visit before moving on to the next depth. Edges outside of
+// the requested scopes are never followed.
+func walk(ctx context.Context, find findFunc, key []byte, options traversal, visit func([]*graphstore.TraversedPair) error) error {
+	visited := map[string]bool{string(key): true}
+	frontier := [][]byte{key}
+
+	for depth := 1; len(frontier) > 0 && (options.maxDepth <= 0 || depth <= options.maxDepth); depth++ {
+		pairs := make([]*graphstore.TraversedPair, 0)
+		next := make([][]byte, 0)
+
+		for _, parent := range frontier {
+			response, err := find(ctx, &store.FindRequest{
+				Key:       parent,
+				EdgeTypes: []string{types.DependsType},
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, pair := range response.GetPairs() {
+				if ok, err := options.follows(pair.GetEdge()); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+
+				pairs = append(pairs, &graphstore.TraversedPair{
+					Edge:  pair.GetEdge(),
+					Node:  pair.GetNode(),
+					Depth: depth,
+				})
+
+				node := pair.GetNode().GetK1()
+				if !visited[string(node)] {
+					visited[string(node)] = true
+					next = append(next, node)
+				}
+			}
+		}
+
+		if err := visit(pairs); err != nil {
+			return err
+		}
+
+		frontier = next
+	}
+
+	return nil
+}
+
+// breadthFirst collects the pairs produced by walk, matching the output of a
+// graphstore.Traverser.
+func breadthFirst(ctx context.Context, find findFunc, key []byte, options traversal) ([]*graphstore.TraversedPair, error) {
+	results := make([]*graphstore.TraversedPair, 0)
+
+	err := walk(ctx, find, key, options, func(pairs []*graphstore.TraversedPair) error {
+		results = append(results, pairs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// traversePairs resolves every depends pair reachable from key. The graph store
+// performs the traversal when it supports doing so. Since the graph store does
+// not understand scopes, the graph is walked one node at a time when filtering
+// on them or when the graph store cannot traverse.
+func traversePairs(ctx context.Context, gs store.GraphStoreClient, key []byte, downstream bool, options traversal) ([]*graphstore.TraversedPair, error) {
+	if traverser, ok := gs.(graphstore.Traverser); ok && len(options.scopes) == 0 {
+		req := &graphstore.TraverseRequest{
+			Key:       key,
+			EdgeTypes: []string{types.DependsType},
+			MaxDepth:  options.maxDepth,
+		}
+
+		var response *graphstore.TraverseResponse
+		var err error
+		if downstream {
+			response, err = traverser.TraverseDownstream(ctx, req)
+		} else {
+			response, err = traverser.TraverseUpstream(ctx, req)
+		}
+
+		if err == nil {
+			return response.Pairs, nil
+		} else if err != api.ErrUnimplemented {
+			return nil, err
+		}
+	}
+
+	if downstream {
+		return breadthFirst(ctx, gs.FindDownstream, key, options)
+	}
+	return breadthFirst(ctx, gs.FindUpstream, key, options)
+}
+
+// traverse collects the transitive closure of the depends edges starting at
+// the provided module. When downstream is true, discovered nodes must come
+// after the node they were discovered from. Otherwise, they must come before it.
+func traverse(ctx context.Context, gs store.GraphStoreClient, module *schema.Module, downstream bool, options traversal) (*topology, error) {
+	key := keyForModule(module)
+	root := moduleReadableKey(key)
+
+	pairs, err := traversePairs(ctx, gs, key, downstream, options)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newTopology(root, module)
+	visited := map[string]bool{root: true}
+
+	for _, pair := range pairs {
+		node := readableKey(pair.Node)
+
+		if downstream {
+			result.require(node, moduleReadableKey(pair.Edge.GetK2()))
+		} else {
+			result.require(moduleReadableKey(pair.Edge.GetK1()), node)
+		}
+
+		if visited[node] {
+			continue
+		}
+		visited[node] = true
+
+		a, err := Decode(pair.Node)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := Decode(pair.Edge)
+		if err != nil {
+			return nil, err
+		}
+
+		result.order = append(result.order, node)
+		result.nodes[node] = &tracker.Dependency{
+			Module:  a.(*schema.Module),
+			Depends: b.(*schema.Depends),
+		}
+	}
+
+	return result, nil
+}
@@ -12,4 +12,12 @@ const (
 	ModuleType DataType = "module"
 	// DependsType represents a Depends
 	DependsType DataType = "depends"
+	// RevisionType represents a Revision of a Source
+	RevisionType DataType = "revision"
+	// RecordsType represents a Source recording a Revision
+	RecordsType DataType = "records"
+	// RevisionSummaryType represents the id and time of a Revision
+	RevisionSummaryType DataType = "revision_summary"
+	// RetainsType represents a Source retaining a RevisionSummary
+	RetainsType DataType = "retains"
 )